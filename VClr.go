@@ -3,16 +3,21 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	vclr "github.com/ArtRand/VClr/lib"
 	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"bufio"
 	"github.com/ArtRand/stats"
+	"strconv"
+	"strings"
 )
 
-func callGatcMethylation(vca *vclr.VcAlignment, threshold *float64) {
-	results := vclr.CallSingleMoleculeGatcMethylation(vca, *threshold)
+func callGatcMethylation(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy) {
+	results := vclr.CallSingleMoleculeGatcMethylation(vca, threshold)
 	for _, readCalls := range results {
 		var methyl float64 = 0.0
 		var hemi float64 = 0.0
@@ -95,7 +100,7 @@ func meanMedianFloatSlice(slc *[]float64) (float64, float64) {
 	return mean, median
 }
 
-func callSingleStrandVariants(vca *vclr.VcAlignment, threshold *float64, reference string) {
+func callSingleStrandVariants(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, reference string) {
 	// first group the alignment by read
 	byRead := vca.GroupByRead()
 	// then get the accuracy for each strand
@@ -110,12 +115,12 @@ func callSingleStrandVariants(vca *vclr.VcAlignment, threshold *float64, referen
 		temScore := math.NaN()
 		comScore := math.NaN()
 		if hasTemplate {
-			templateResults := vclr.CallSingleMoleculeCanonicalVariants(byStrand["t"], *threshold)
+			templateResults := vclr.CallSingleMoleculeCanonicalVariants(byStrand["t"], threshold)
 			templateAccuracy, temScore = compareCallsToReference(templateResults, reference)
 			templateAccuracies = append(templateAccuracies, templateAccuracy)
 		}
 		if hasComplement {
-			complementResults := vclr.CallSingleMoleculeCanonicalVariants(byStrand["c"], *threshold)
+			complementResults := vclr.CallSingleMoleculeCanonicalVariants(byStrand["c"], threshold)
 			complementAccuracy, comScore = compareCallsToReference(complementResults, reference)
 			complementAccuracies = append(complementAccuracies, complementAccuracy)
 		}
@@ -127,13 +132,147 @@ func callSingleStrandVariants(vca *vclr.VcAlignment, threshold *float64, referen
 	fmt.Fprintf(os.Stderr, "mean complement accuracy %v, median %v\n", complementMean, complementMedian)
 }
 
-func callSingleStrandMethylation(vca *vclr.VcAlignment, threshold *float64) {
+func singleStrandErrorProfile(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, reference string) {
+	profile := vclr.SingleMoleculeErrorProfile(vca, threshold, reference)
+	labels := make([]string, 0, len(profile.Matrices))
+	for label := range profile.Matrices {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	// one confusion matrix per strand and orientation, reference bases are rows and called bases are columns
+	for _, label := range labels {
+		matrix := profile.Matrices[label]
+		alphabet := matrix.Alphabet()
+		fmt.Printf("# %v\n%-5s", label, "ref")
+		for _, call := range alphabet {
+			fmt.Printf("\t%-8s", call)
+		}
+		fmt.Printf("\n")
+		for _, ref := range alphabet {
+			fmt.Printf("%-5s", ref)
+			for _, call := range alphabet {
+				fmt.Printf("\t%-8v", matrix.Count(ref, call))
+			}
+			fmt.Printf("\n")
+		}
+	}
+	sites := make([]int, 0, len(profile.Positions))
+	for site := range profile.Positions {
+		sites = append(sites, site)
+	}
+	sort.Ints(sites)
+	fmt.Printf("# positions\n%-10s\t%-5s\t%-8s\t%-8s\t%-10s\n", "Site", "Ref", "n_calls", "n_errors", "error_rate")
+	for _, site := range sites {
+		stats := profile.Positions[site]
+		fmt.Printf("%-10v\t%-5s\t%-8v\t%-8v\t%-10.4f\n", site, string(reference[site]), stats.NumberOfCalls(),
+			stats.NumberOfErrors(), stats.ErrorRate())
+	}
+}
+
+func variantContexts(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, reference string, k int) {
+	contexts := vclr.SingleMoleculeVariantContexts(vca, threshold, reference, k)
+	kmers := make([]string, 0, len(contexts))
+	for kmer := range contexts {
+		kmers = append(kmers, kmer)
+	}
+	sort.Strings(kmers)
+	fmt.Printf("%-10s\t%-8s\t%-8s\t%-10s\n", "kmer", "n_calls", "n_errors", "p_correct")
+	for _, kmer := range kmers {
+		stats := contexts[kmer]
+		fmt.Printf("%-10s\t%-8v\t%-8v\t%-10.4f\n", kmer, stats.NumberOfCalls(), stats.NumberOfErrors(),
+			stats.PercentCorrect())
+	}
+}
+
+func methylationContexts(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, reference string, k int) {
+	contexts := vclr.SingleMoleculeMethylationContexts(vca, threshold, reference, k)
+	kmers := make([]string, 0, len(contexts))
+	for kmer := range contexts {
+		kmers = append(kmers, kmer)
+	}
+	sort.Strings(kmers)
+	fmt.Printf("%-10s\t%-8s\t%-8s\t%-10s\n", "kmer", "n_calls", "n_methyl", "p_Called_Methyl")
+	for _, kmer := range kmers {
+		stats := contexts[kmer]
+		fmt.Printf("%-10s\t%-8v\t%-8v\t%-10.4f\n", kmer, stats.NumberOfCalls(), stats.NumberOfMethylatedCalls(),
+			stats.PercentMethylatedCalls())
+	}
+}
+
+func exportSingleMoleculeCalls(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, fastq bool) {
+	results := vclr.CallSingleMoleculeCanonicalVariants(vca, threshold)
+	sort.Slice(results, func(i, j int) bool { return results[i][0].ReadLabel < results[j][0].ReadLabel })
+	if !fastq {
+		fmt.Printf("%-20s\t%-10s\t%-5s\t%-10s\t%-5s\n", "Read", "Site", "Call", "Prob", "Qual")
+	}
+	for _, readCalls := range results {
+		if fastq {
+			smSeq := vclr.SingleMoleculeSequenceConstruct(readCalls)
+			if smSeq == nil {
+				continue
+			}
+			name := fmt.Sprintf("%v start=%v end=%v", smSeq.ReadLabel, smSeq.Start, smSeq.End)
+			vclr.WriteFastq(os.Stdout, name, smSeq.Seq, smSeq.Qual)
+			continue
+		}
+		sort.Slice(readCalls, func(i, j int) bool { return readCalls[i].RefPos < readCalls[j].RefPos })
+		for _, vc := range readCalls {
+			if vc.Call == "" {
+				continue
+			}
+			fmt.Printf("%-20s\t%-10v\t%-5s\t%-10.4f\t%-5v\n", vc.ReadLabel, vc.RefPos, vc.Call, vc.Prob,
+				vclr.ProbToPhred(vc.Prob))
+		}
+	}
+}
+
+// strandPercentMethyl is the percent of sites called methylated on one strand of a read and the strand's score, in
+// log-likelihood ratio mode (llrCutoff > 0) only confidently called sites count and the number of ambiguous sites is
+// returned as well
+func strandPercentMethyl(strandAln *vclr.VcAlignment, threshold *vclr.ThresholdPolicy,
+	llrCutoff float64) (float64, float64, int) {
+	if llrCutoff > 0 {
+		llrStats := vclr.LlrCallStats(vclr.CallSingleMoleculeMethylationSites(strandAln, threshold), llrCutoff)
+		return llrStats.PercentMethylatedCalls(), strandAln.ScoreRead(), llrStats.NumberOfAmbiguousCalls()
+	}
+	results := vclr.CallSingleMoleculeMethylation(strandAln, threshold)
+	percentMethyl, score := calculatePercentCalledMethyl(results)
+	return percentMethyl, score, 0
+}
+
+// strandMethylation is each read's percent methylated and score on one strand, reads without a confident call on the
+// strand (all ambiguous in log-likelihood ratio mode) are left out so they don't make the summaries NaN
+type strandMethylation struct {
+	percents []float64
+	scores   []float64
+}
+
+func strandMethylationConstruct() *strandMethylation {
+	return &strandMethylation{percents: make([]float64, 0), scores: make([]float64, 0)}
+}
+
+func (self *strandMethylation) add(percentMethyl, score float64) {
+	if math.IsNaN(percentMethyl) {
+		return
+	}
+	self.percents = append(self.percents, percentMethyl)
+	self.scores = append(self.scores, score)
+}
+
+// summary is the mean and median percent methylated and its Pearson's R with the read score
+func (self *strandMethylation) summary() (float64, float64, float64) {
+	mean, median := meanMedianFloatSlice(&self.percents)
+	pearsons, _ := stats.Pearson(self.percents, self.scores)
+	return mean, median, pearsons
+}
+
+// singleStrandMethylation writes a row per read to out and collects the template and complement strands
+func singleStrandMethylation(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, llrCutoff float64,
+	out io.Writer) (*strandMethylation, *strandMethylation) {
 	// first group the alignment by read
 	byRead := vca.GroupByRead()
-	templateMethylPercents := make([]float64, 0)
-	complementMethylPercents := make([]float64, 0)
-	templateScores := make([]float64, 0)
-	complementScores := make([]float64, 0)
+	template := strandMethylationConstruct()
+	complement := strandMethylationConstruct()
 	for read, aln := range byRead {
 		byStrand := aln.GroupByStrand()
 		_, hasTemplate := byStrand["t"]
@@ -142,75 +281,639 @@ func callSingleStrandMethylation(vca *vclr.VcAlignment, threshold *float64) {
 		com_percentMethyl := math.NaN()
 		temScore := math.NaN()
 		comScore := math.NaN()
+		temAmbiguous := 0
+		comAmbiguous := 0
 		if hasTemplate {
-			templateResults := vclr.CallSingleMoleculeMethylation(byStrand["t"], *threshold)
-			tem_percentMethyl, temScore = calculatePercentCalledMethyl(templateResults)
-			templateMethylPercents = append(templateMethylPercents, tem_percentMethyl)
-			templateScores = append(templateScores, temScore)
+			tem_percentMethyl, temScore, temAmbiguous = strandPercentMethyl(byStrand["t"], threshold, llrCutoff)
+			template.add(tem_percentMethyl, temScore)
 		}
 		if hasComplement {
-			complementResults := vclr.CallSingleMoleculeMethylation(byStrand["c"], *threshold)
-			com_percentMethyl, comScore = calculatePercentCalledMethyl(complementResults)
-			complementMethylPercents = append(complementMethylPercents, com_percentMethyl)
-			complementScores = append(complementScores, comScore)
+			com_percentMethyl, comScore, comAmbiguous = strandPercentMethyl(byStrand["c"], threshold, llrCutoff)
+			complement.add(com_percentMethyl, comScore)
+		}
+		if llrCutoff > 0 {
+			fmt.Fprintf(out, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", read, tem_percentMethyl, com_percentMethyl,
+				temScore, comScore, temAmbiguous, comAmbiguous)
+		} else {
+			fmt.Fprintf(out, "%v\t%v\t%v\t%v\t%v\n", read, tem_percentMethyl, com_percentMethyl, temScore, comScore)
 		}
-		fmt.Fprintf(os.Stdout, "%v\t%v\t%v\t%v\t%v\n", read, tem_percentMethyl, com_percentMethyl, temScore, comScore)
 	}
-	templateMean, templateMedian := meanMedianFloatSlice(&templateMethylPercents)
-	complementMean, complementMedian := meanMedianFloatSlice(&complementMethylPercents)
-	templatePearsons, _ := stats.Pearson(templateMethylPercents, templateScores)
-	complementPearsons, _ := stats.Pearson(complementMethylPercents, complementScores)
+	return template, complement
+}
+
+func callSingleStrandMethylation(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, llrCutoff float64) {
+	template, complement := singleStrandMethylation(vca, threshold, llrCutoff, os.Stdout)
+	templateMean, templateMedian, templatePearsons := template.summary()
+	complementMean, complementMedian, complementPearsons := complement.summary()
 
 	fmt.Fprintf(os.Stderr, "mean template accuracy %v, median %v, Pearson's R %v\n", templateMean, templateMedian, templatePearsons)
 	fmt.Fprintf(os.Stderr, "mean complement accuracy %v, median %v, Pearson's R %v\n", complementMean, complementMedian, complementPearsons)
 }
 
-func singleMoleculeSiteStats(vca *vclr.VcAlignment, threshold *float64) {
+func singleMoleculeMethylationSites(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy) {
+	results := vclr.CallSingleMoleculeMethylationSites(vca, threshold)
+	fmt.Printf("%-20s\t%-6s\t%-10s\t%-5s\t%-10s\t%-10s\t%-10s\n", "Read", "Strand", "Site", "Call", "Prob",
+		"LLR", "ReadScore")
+	for _, mc := range results {
+		fmt.Printf("%-20s\t%-6s\t%-10v\t%-5s\t%-10.4f\t%-10.4f\t%-10.4f\n", mc.ReadLabel, mc.Strand, mc.RefPos,
+			mc.Call, mc.Prob, mc.Llr, mc.ReadScore)
+	}
+}
+
+// singleMoleculeCallStats accumulates each read's calls at each site, by log-likelihood ratio if llrCutoff > 0
+func singleMoleculeCallStats(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy,
+	llrCutoff float64) map[int]*vclr.SiteCallStats {
+	if llrCutoff > 0 {
+		return vclr.SingleMoleculeSiteCallsByLlr(vca, threshold, llrCutoff)
+	}
+	return vclr.SingleMoleculeSiteCalls(vca, threshold)
+}
+
+// siteReportOptions are the output options shared by the site level tools (sm-site-stats, variant and methyl)
+type siteReportOptions struct {
+	llrCutoff      float64
+	alpha          float64
+	nBootstrap     int
+	seed           int64
+	annotator      *vclr.Annotator
+	featureSummary string
+	reference      string
+	strandBias     bool
+	minStrandP     float64
+	fullProbs      bool
+	background     *vclr.BackgroundModel
+	maxBackground  float64
+}
+
+func singleMoleculeSiteStats(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, opts *siteReportOptions) {
 	// a map of ref_positions to call stats
-	siteCalls := make(map[int]*vclr.SiteCallStats)
-	// group by read first, because there could be many more sites than reads, and each read will only
-	// map to a subset of the sites
-	byRead := vca.GroupByRead()
-	for _, readDf := range byRead {
-		// now go over all the sites reported on by this read
-		bySite := readDf.GroupBySite()
-		for site, siteDf := range bySite {
-			call, _, _ := vclr.CallSiteMethylation(siteDf, *threshold)
-			_, check := siteCalls[site]
-			if !check {
-				siteCalls[site] = vclr.SiteCallStatsConstruct()
-				siteCalls[site].AddCall(call)
-			} else {
-				siteCalls[site].AddCall(call)
+	siteCalls := singleMoleculeCallStats(vca, threshold, opts.llrCutoff)
+	if len(siteCalls) == 0 {
+		panic("Didn't accumulate any site calls?")
+	}
+	rng := rand.New(rand.NewSource(opts.seed))
+	// output the results, percentages are NaN for sites without any (confident) calls
+	fmt.Printf("%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s", "Site",
+		"p_Called_Methyl ", "p_Called_Non-methyl", "n_reads", "wilson_lo", "wilson_hi", "cp_lo", "cp_hi",
+		"p_Posterior_Methyl", "posterior_lo", "posterior_hi")
+	if opts.nBootstrap > 0 {
+		fmt.Printf("\t%-10s\t%-10s", "boot_lo", "boot_hi")
+	}
+	if opts.llrCutoff > 0 {
+		fmt.Printf("\t%-10s", "n_ambiguous")
+	}
+	if opts.background != nil {
+		printBackgroundHeader()
+	}
+	printAnnotationHeader(opts.annotator)
+	fmt.Printf("\n")
+	for _, site := range sortedSites(siteCalls) {
+		stats := siteCalls[site]
+		wilsonLo, wilsonHi := stats.WilsonInterval(opts.alpha)
+		cpLo, cpHi := stats.ClopperPearsonInterval(opts.alpha)
+		lo, hi := stats.PosteriorInterval(opts.alpha)
+		fmt.Printf("%-10v\t%-20.4f\t%-20.4f\t%-10v\t%-10.4f\t%-10.4f\t%-10.4f\t%-10.4f\t%-10.4f\t%-10.4f\t%-10.4f",
+			site, stats.PercentMethylatedCalls(), stats.PercentCanonicalCalls(), stats.NumberOfCalls(), wilsonLo,
+			wilsonHi, cpLo, cpHi, stats.PosteriorPercentMethylated(), lo, hi)
+		if opts.nBootstrap > 0 {
+			bootLo, bootHi := stats.BootstrapInterval(opts.nBootstrap, opts.alpha, rng)
+			fmt.Printf("\t%-10.4f\t%-10.4f", bootLo, bootHi)
+		}
+		if opts.llrCutoff > 0 {
+			fmt.Printf("\t%-10v", stats.NumberOfAmbiguousCalls())
+		}
+		if opts.background != nil {
+			printBackground(opts, site, stats)
+		}
+		printAnnotation(opts.annotator, site)
+		fmt.Printf("\n")
+	}
+	if opts.featureSummary != "" {
+		writeFeatureMethylation(opts.featureSummary, siteCalls, vclr.CallSingleMoleculeMethylation(vca, threshold),
+			opts.annotator)
+	}
+}
+
+// sortedSites returns the sites in siteCalls in order, so that bootstrap results are reproducible for a given seed
+func sortedSites(siteCalls map[int]*vclr.SiteCallStats) []int {
+	sites := make([]int, 0, len(siteCalls))
+	for site := range siteCalls {
+		sites = append(sites, site)
+	}
+	sort.Ints(sites)
+	return sites
+}
+
+func methylationWindows(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, features []*vclr.Feature, window, step,
+	minSites int) {
+	siteCalls := vclr.SingleMoleculeSiteCalls(vca, threshold)
+	readCalls := vclr.CallSingleMoleculeMethylation(vca, threshold)
+	var windows []*vclr.MethylationWindow
+	if features != nil {
+		windows = vclr.FeatureMethylation(siteCalls, readCalls, features, minSites)
+	} else {
+		windows = vclr.SlidingWindowMethylation(siteCalls, readCalls, window, step, minSites)
+	}
+	fmt.Printf("%-20s\t%-10s\t%-10s\t%-8s\t%-10s\t%-10s\t%-10s\t%-10s\n", "Name", "Start", "End", "n_sites",
+		"coverage", "mean_p_Methyl", "n_informative_reads", "heterogeneity")
+	for _, w := range windows {
+		name := w.Name
+		if name == "" {
+			name = "."
+		}
+		fmt.Printf("%-20s\t%-10v\t%-10v\t%-8v\t%-10v\t%-10.4f\t%-10v\t%-10.4f\n", name, w.Start, w.End, w.NSites,
+			w.Coverage, w.MeanPercentMethylated(), w.NumberOfInformativeReads(), w.Heterogeneity())
+	}
+}
+
+func coMethylation(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, gatc bool, maxDistance, minReads int) {
+	var readCalls [][]*vclr.VariantCall
+	if gatc {
+		readCalls = vclr.CallSingleMoleculeGatcMethylation(vca, threshold)
+	} else {
+		readCalls = vclr.CallSingleMoleculeMethylation(vca, threshold)
+	}
+	results := vclr.CoMethylation(readCalls, maxDistance, minReads)
+	fmt.Printf("%-10s\t%-10s\t%-8s\t%-8s\t%-6s\t%-6s\t%-6s\t%-6s\t%-10s\t%-10s\n", "Site_A", "Site_B", "distance",
+		"n_reads", "MM", "MU", "UM", "UU", "r2", "D'")
+	for _, l := range results {
+		fmt.Printf("%-10v\t%-10v\t%-8v\t%-8v\t%-6v\t%-6v\t%-6v\t%-6v\t%-10.4f\t%-10.4f\n", l.SiteA, l.SiteB,
+			l.SiteB-l.SiteA, l.NumberOfInformativeReads(), l.NMM, l.NMU, l.NUM, l.NUU, l.RSquared(), l.DPrime())
+	}
+}
+
+func clusterReads(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, methyl, gatc bool, start, end, k,
+	minCalls int, seed int64) {
+	var readCalls [][]*vclr.VariantCall
+	switch {
+	case !methyl:
+		readCalls = vclr.CallSingleMoleculeCanonicalVariants(vca, threshold)
+	case gatc:
+		readCalls = vclr.CallSingleMoleculeGatcMethylation(vca, threshold)
+	default:
+		readCalls = vclr.CallSingleMoleculeMethylation(vca, threshold)
+	}
+	matrix := vclr.ReadSiteMatrixConstruct(readCalls, start, end, methyl, minCalls)
+	if len(matrix.Reads) == 0 {
+		panic("No reads with calls in the region")
+	}
+	clusters := vclr.KModes(matrix, k, 100, rand.New(rand.NewSource(seed)))
+	fmt.Printf("%-20s\t%-8s\t%-8s\t%-10s\n", "Read", "cluster", "n_sites", "distance")
+	for i, read := range matrix.Reads {
+		nCalled := 0
+		for _, v := range matrix.Values[i] {
+			if v != "" {
+				nCalled += 1
 			}
 		}
+		fmt.Printf("%-20s\t%-8v\t%-8v\t%-10.4f\n", read, clusters.Assignments[i], nCalled, clusters.Distances[i])
 	}
-	if len(siteCalls) == 0 {
-		panic("Didn't accumulate any site calls?")
+	// per-cluster consensus goes to stderr, like the summaries of the other tools
+	sizes := make(map[int]int)
+	for _, c := range clusters.Assignments {
+		sizes[c] += 1
+	}
+	fmt.Fprintf(os.Stderr, "%-8s\t%-8s\t%-10s\t%-10s\t%-10s\n", "cluster", "n_reads", "Site", "consensus", "support")
+	for c, consensus := range clusters.Consensus {
+		for j, site := range matrix.Sites {
+			if consensus[j] == "" {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%-8v\t%-8v\t%-10v\t%-10s\t%-10.4f\n", c, sizes[c], site, consensus[j],
+				clusters.Support[c][j])
+		}
+	}
+}
+
+func alleleSpecificMethylation(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, alleleSite int, minProb,
+	llrCutoff float64) {
+	assignments := vclr.AssignReadsToAlleles(vca, alleleSite, threshold, minProb)
+	alleles := vclr.CountAlleles(assignments)
+	for _, a := range alleles {
+		fmt.Fprintf(os.Stderr, "allele %v: %v reads\n", a.Allele, a.NReads)
+	}
+	if len(alleles) < 2 {
+		panic(fmt.Sprintf("Need reads from at least two alleles at site %v, found %v", alleleSite, len(alleles)))
 	}
-	// output the results
-	fmt.Printf("%-10s\t%-10s\t%-10s\t%-10s\n", "Site", "p_Called_Methyl ", "p_Called_Non-methyl", "n_reads")
-	for site, stats := range siteCalls {
-		fmt.Printf("%-10v\t%-20.4f\t%-20.4f\t%-10v\n", site, stats.PercentMethylatedCalls(), stats.PercentCanonicalCalls(), stats.NumberOfCalls())
+	// compare the two most common alleles
+	byAllele := vclr.AlleleAlignments(vca, assignments, alleleSite)
+	alleleA := alleles[0].Allele
+	alleleB := alleles[1].Allele
+	callsA := singleMoleculeCallStats(byAllele[alleleA], threshold, llrCutoff)
+	callsB := singleMoleculeCallStats(byAllele[alleleB], threshold, llrCutoff)
+	results := vclr.DifferentialMethylation(callsA, callsB, 0)
+	fmt.Printf("%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\n", "Site", alleleA+"_methyl",
+		alleleA+"_total", alleleB+"_methyl", alleleB+"_total", "delta_p", "p_value", "q_value")
+	for _, r := range results {
+		fmt.Printf("%-10v\t%-10v\t%-10v\t%-10v\t%-10v\t%-10.4f\t%-10.4g\t%-10.4g\n", r.Start,
+			r.Case.NumberOfMethylatedCalls(), r.Case.NumberOfCalls(), r.Control.NumberOfMethylatedCalls(),
+			r.Control.NumberOfCalls(), r.DeltaPercentMethylated(), r.PValue, r.QValue)
 	}
 }
 
-func callSites(vca *vclr.VcAlignment, threshold *float64, canonical bool) {
+func differentialMethylation(caseAlns, controlAlns *vclr.VcAlignment, threshold *vclr.ThresholdPolicy,
+	llrCutoff float64, window int) {
+	caseCalls := singleMoleculeCallStats(caseAlns, threshold, llrCutoff)
+	controlCalls := singleMoleculeCallStats(controlAlns, threshold, llrCutoff)
+	results := vclr.DifferentialMethylation(caseCalls, controlCalls, window)
+	if len(results) == 0 {
+		panic("No sites with calls in both case and control")
+	}
+	fmt.Printf("%-10s\t%-10s\t%-8s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\t%-10s\n", "Start", "End",
+		"n_sites", "case_methyl", "case_total", "ctrl_methyl", "ctrl_total", "delta_p", "p_value", "q_value")
+	for _, r := range results {
+		fmt.Printf("%-10v\t%-10v\t%-8v\t%-10v\t%-10v\t%-10v\t%-10v\t%-10.4f\t%-10.4g\t%-10.4g\n", r.Start, r.End,
+			r.NSites, r.Case.NumberOfMethylatedCalls(), r.Case.NumberOfCalls(), r.Control.NumberOfMethylatedCalls(),
+			r.Control.NumberOfCalls(), r.DeltaPercentMethylated(), r.PValue, r.QValue)
+	}
+}
+
+func printStrata(name string, strata *vclr.Strata) {
+	fmt.Fprintf(os.Stderr, "%-14s\t%-8s\t%-8s\t%-8s\t%-10s\t%-10s\t%-10s\n", name, "TP", "FP", "FN",
+		"precision", "recall", "F1")
+	for i, counts := range strata.Counts {
+		fmt.Fprintf(os.Stderr, "%-14s\t%-8v\t%-8v\t%-8v\t%-10.4f\t%-10.4f\t%-10.4f\n", strata.Label(i), counts.TP,
+			counts.FP, counts.FN, counts.Precision(), counts.Recall(), counts.F1())
+	}
+}
+
+func benchmarkCalls(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, reference string, truth map[int]string,
+	singleMolecule bool, coverageEdges, probEdges []float64) {
+	var report *vclr.BenchmarkReport
+	if singleMolecule {
+		report = vclr.BenchmarkSingleMoleculeCalls(vca, threshold, reference, truth, coverageEdges, probEdges)
+	} else {
+		report = vclr.BenchmarkSiteCalls(vca, threshold, reference, truth, coverageEdges, probEdges)
+	}
+	sites := make([]int, 0, len(report.Sites))
+	for site := range report.Sites {
+		sites = append(sites, site)
+	}
+	sort.Ints(sites)
+	fmt.Printf("%-10s\t%-5s\t%-5s\t%-8s\t%-8s\t%-8s\t%-8s\t%-10s\t%-10s\t%-10s\n", "Site", "Ref", "Truth", "TP",
+		"FP", "FN", "TN", "precision", "recall", "F1")
+	for _, site := range sites {
+		counts := report.Sites[site]
+		truthBase, isVariant := truth[site]
+		if !isVariant {
+			truthBase = string(reference[site])
+		}
+		fmt.Printf("%-10v\t%-5s\t%-5s\t%-8v\t%-8v\t%-8v\t%-8v\t%-10.4f\t%-10.4f\t%-10.4f\n", site,
+			string(reference[site]), truthBase, counts.TP, counts.FP, counts.FN, counts.TN, counts.Precision(),
+			counts.Recall(), counts.F1())
+	}
+	total := report.Total
+	fmt.Fprintf(os.Stderr, "TP %v, FP %v, FN %v, TN %v, precision %v, recall %v, F1 %v\n", total.TP, total.FP,
+		total.FN, total.TN, total.Precision(), total.Recall(), total.F1())
+	printStrata("coverage", report.ByCoverage)
+	printStrata("prob", report.ByProb)
+}
+
+func polishReference(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, name, reference string, minCoverage int,
+	minProb float64, maskLowercase bool, changeLog io.Writer) {
+	consensus, substitutions := vclr.PolishReference(reference, vca, threshold, minCoverage, minProb, maskLowercase)
+	vclr.WriteFasta(os.Stdout, name, consensus, 60)
+	fmt.Fprintf(changeLog, "%-10s\t%-5s\t%-5s\t%-10s\t%-8s\n", "Site", "Ref", "Call", "Coverage", "Prob")
+	for _, sub := range substitutions {
+		fmt.Fprintf(changeLog, "%-10v\t%-5s\t%-5s\t%-10v\t%-10.4f\n", sub.RefPos, sub.RefBase, sub.Call,
+			sub.Coverage, sub.Prob)
+	}
+}
+
+func phaseVariants(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, name, reference, sample string,
+	minCoverage int, minProb float64, readTable io.Writer) {
+	sites := vclr.VariantSites(vca, threshold, reference, minCoverage, minProb)
+	phasing := vclr.PhaseVariants(vca, sites, threshold)
+	vclr.WritePhasedVcf(os.Stdout, name, sample, phasing.Sites)
+	fmt.Fprintf(readTable, "%-10s\t%-10s\t%-10s\t%-10s\t%-10s\n", "Read", "Block", "Haplotype", "nSites",
+		"nAgree")
+	for _, r := range phasing.Reads {
+		fmt.Fprintf(readTable, "%-10s\t%-10v\t%-10v\t%-10v\t%-10v\n", r.ReadLabel, r.Block+1, r.Haplotype,
+			r.NSites, r.NAgree)
+	}
+}
+
+func strainMixture(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, profile *vclr.StrainProfile, minSites int,
+	alpha float64, readTable io.Writer) {
+	mixture := vclr.AssignReadsToStrains(vca, profile, threshold, minSites)
+	counts := mixture.Counts()
+	fmt.Printf("%-10s\t%-10s\t%-10s\t%-10s\t%-10s\n", "Strain", "nReads", "Proportion", "lo", "hi")
+	for _, strain := range mixture.Strains {
+		p, lo, hi := mixture.Proportion(strain, alpha)
+		fmt.Printf("%-10s\t%-10v\t%-10.4f\t%-10.4f\t%-10.4f\n", strain, counts[strain], p, lo, hi)
+	}
+	// unassigned is a fraction of all the reads, not of the assigned ones
+	unassigned := counts[vclr.Unassigned]
+	lo, hi := vclr.WilsonInterval(unassigned, len(mixture.Reads), alpha)
+	fmt.Printf("%-10s\t%-10v\t%-10.4f\t%-10.4f\t%-10.4f\n", vclr.Unassigned, unassigned,
+		float64(unassigned)/float64(len(mixture.Reads)), lo, hi)
+	fmt.Fprintf(os.Stderr, "%v strain-defining sites, %v of %v reads assigned\n", len(profile.Sites),
+		mixture.NumberAssigned(), len(mixture.Reads))
+	fmt.Fprintf(readTable, "%-10s\t%-10s\t%-10s\t%-10s\t%-10s\n", "Read", "Strain", "nSites", "LogLik",
+		"Margin")
+	for _, r := range mixture.Reads {
+		fmt.Fprintf(readTable, "%-10s\t%-10s\t%-10v\t%-10.4f\t%-10.4f\n", r.ReadLabel, r.Strain, r.NSites,
+			r.LogLikelihood, r.Margin)
+	}
+}
+
+func loadStrainProfile(path string) *vclr.StrainProfile {
+	fH, ok := os.Open(path)
+	check(ok, fmt.Sprintf("Error opening file %v", path))
+	defer fH.Close()
+	if strings.HasSuffix(strings.ToLower(path), ".vcf") {
+		profile, err := vclr.StrainProfileFromVcf(vclr.ParseVcf(fH))
+		check(err, fmt.Sprintf("Error reading strains from %v: %v", path, err))
+		return profile
+	}
+	return vclr.ParseStrainTable(fH)
+}
+
+func trainCalibration(vca *vclr.VcAlignment, truth, reference, method string, minPoints int) {
+	var calibration *vclr.Calibration
+	if truth == "reference" {
+		calibration = vclr.TrainCalibrationFromReference(vca, reference, method, minPoints)
+	} else {
+		calibration = vclr.TrainCalibrationFromControl(vca, truth == "modified", method, minPoints)
+	}
+	vclr.WriteCalibration(os.Stdout, calibration)
+	fmt.Fprintf(os.Stderr, "%-8s\t%-5s\t%-10s\t%-10s\t%-10s\t%-12s\t%-12s\n", "Strand", "Base", "n", "fCorrect",
+		"meanProb", "brierBefore", "brierAfter")
+	for _, s := range calibration.Summary {
+		fmt.Fprintf(os.Stderr, "%-8s\t%-5s\t%-10v\t%-10.4f\t%-10.4f\t%-12.4f\t%-12.4f\n", s.Strand, s.Base, s.N,
+			s.FracCorrect, s.MeanProb, s.BrierBefore, s.BrierAfter)
+	}
+}
+
+func titration(sets []titrationSet, calibration *vclr.Calibration, threshold *vclr.ThresholdPolicy,
+	strandFilter string, readScore *readScoreFilter, llrCutoff float64, minCalls int) {
+	samples := make([]*vclr.TitrationSample, 0, len(sets))
+	for _, set := range sets {
+		vca := prepareAlignment(loadAlignments(set.glob), calibration, strandFilter, readScore)
+		samples = append(samples, &vclr.TitrationSample{Label: set.label, Expected: 100 * set.fraction,
+			Sites: singleMoleculeCallStats(vca, threshold, llrCutoff)})
+	}
+	result := vclr.Titration(samples, minCalls)
+	fmt.Printf("%-10s", "Site")
+	for _, sample := range result.Samples {
+		fmt.Printf("\tobs_%-10s", sample.Label)
+	}
+	for _, sample := range result.Samples {
+		fmt.Printf("\tres_%-10s", sample.Label)
+	}
+	fmt.Printf("\t%-10s\n", "mean_abs_res")
+	for _, st := range result.Sites {
+		fmt.Printf("%-10v", st.Site)
+		for _, obs := range st.Observed {
+			fmt.Printf("\t%-14.4f", obs)
+		}
+		for _, res := range st.Residuals {
+			fmt.Printf("\t%-14.4f", res)
+		}
+		fmt.Printf("\t%-10.4f\n", st.MeanAbsResidual)
+	}
+	fmt.Fprintf(os.Stderr, "%-10s\t%-10s\t%-10s\t%-10s\n", "Sample", "Expected", "Observed", "Residual")
+	for i, sample := range result.Samples {
+		fmt.Fprintf(os.Stderr, "%-10s\t%-10.4f\t%-10.4f\t%-10.4f\n", sample.Label, sample.Expected,
+			result.Pooled[i], result.Pooled[i]-result.PooledFit.Predict(sample.Expected))
+	}
+	fmt.Fprintf(os.Stderr, "genome-wide fit: slope %.4f, intercept %.4f, R^2 %.4f, %v samples\n",
+		result.PooledFit.Slope, result.PooledFit.Intercept, result.PooledFit.RSquared, result.PooledFit.N)
+	fmt.Fprintf(os.Stderr, "per-site fit: slope %.4f, intercept %.4f, R^2 %.4f, %v points from %v sites\n",
+		result.SiteFit.Slope, result.SiteFit.Intercept, result.SiteFit.RSquared, result.SiteFit.N,
+		len(result.Sites))
+}
+
+func readScoreReport(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, reference string, width,
+	target float64) {
+	scores := vclr.ReadStrandScores(vca, threshold, reference)
+	metric := "methylated"
+	if reference != "" {
+		metric = "accuracy"
+	}
+	fmt.Printf("%-8s\t%-10s\t%-10s\t%-10s\tmean_%-10s\n", "Strand", "score_lo", "score_hi", "n_reads", metric)
+	for _, strand := range []string{"t", "c"} {
+		for _, b := range vclr.BinReadScores(scores, strand, width) {
+			fmt.Printf("%-8s\t%-10.2f\t%-10.2f\t%-10v\t%-15.4f\n", strand, b.Lo, b.Hi, b.NReads, b.MeanValue)
+		}
+	}
+	for _, strand := range []string{"t", "c"} {
+		cutoff, mean, nReads := vclr.RecommendReadScoreCutoff(scores, strand, target)
+		if math.IsNaN(cutoff) {
+			fmt.Fprintf(os.Stderr, "strand %v: no read score cutoff reaches %v%% %v\n", strand, target, metric)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "strand %v: -s %.2f keeps %v reads with mean %v %.4f%%\n", strand, cutoff, nReads,
+			metric, mean)
+	}
+}
+
+func callSites(vca *vclr.VcAlignment, threshold *vclr.ThresholdPolicy, canonical bool, opts *siteReportOptions) {
 	// group the alignment by site
 	bySite := vca.GroupBySite()
-	fmt.Printf("%-10s\t%-5s\t%-5s\t%-8s\n", "Site", "Call", "Coverage", "Prob")
+	if canonical {
+		fmt.Printf("%-10s\t%-5s\t%-5s\t%-8s", "Site", "Call", "Coverage", "Prob")
+	} else {
+		fmt.Printf("%-10s\t%-5s\t%-5s\t%-8s\t%-10s\t%-10s\t%-10s", "Site", "Call", "Coverage", "Prob",
+			"p_Posterior_Methyl", "posterior_lo", "posterior_hi")
+	}
+	if opts.strandBias {
+		printStrandBiasHeader()
+	}
+	if opts.fullProbs {
+		printProbsHeader(canonical)
+	}
+	if !canonical && opts.background != nil {
+		printBackgroundHeader()
+	}
+	printAnnotationHeader(opts.annotator)
+	fmt.Printf("\n")
+	calls := make(map[int]string)
+	nFiltered := 0
 	for site, aln := range bySite {
 		var call string
 		var coverage int
 		var prob float64
 		if !canonical {
-			call, coverage, prob = vclr.CallSiteMethylation(aln, *threshold)
-			fmt.Printf("%-10v\t%-5s\t%-10v\t%-10.4f\n", site, call, coverage, prob)
+			call, coverage, prob = vclr.CallSiteMethylation(aln, threshold)
 		} else {
-			call, coverage, prob = vclr.CallSite(aln, *threshold)
-			fmt.Printf("%-10v\t%-5s\t%-10v\t%-10.4f\n", site, call, coverage, prob)
+			call, coverage, prob = vclr.CallSite(aln, threshold)
 		}
+		var stats *vclr.SiteCallStats
+		var bias *vclr.StrandBias
+		if opts.strandBias || opts.minStrandP > 0 {
+			bias = vclr.SiteStrandBias(aln, call, threshold, canonical)
+			if call != "" && bias.PValue() < opts.minStrandP {
+				nFiltered += 1
+				continue
+			}
+		}
+		if !canonical {
+			stats = vclr.SiteMethylationStats(aln, threshold)
+			lo, hi := stats.PosteriorInterval(opts.alpha)
+			fmt.Printf("%-10v\t%-5s\t%-10v\t%-10.4f\t%-10.4f\t%-10.4f\t%-10.4f", site, call, coverage, prob,
+				stats.PosteriorPercentMethylated(), lo, hi)
+		} else {
+			fmt.Printf("%-10v\t%-5s\t%-10v\t%-10.4f", site, call, coverage, prob)
+		}
+		if opts.strandBias {
+			printStrandBias(bias)
+		}
+		if opts.fullProbs {
+			if canonical {
+				printProbs(aln.SiteProbsOnCodingStrand(threshold), call, canonical)
+			} else {
+				printProbs(aln.SiteProbsOnStrand(threshold), call, canonical)
+			}
+		}
+		if !canonical && opts.background != nil {
+			printBackground(opts, site, stats)
+		}
+		printAnnotation(opts.annotator, site)
+		fmt.Printf("\n")
+		calls[site] = call
+	}
+	if opts.minStrandP > 0 {
+		fmt.Fprintf(os.Stderr, "%v sites removed with strand bias p-value below %v\n", nFiltered, opts.minStrandP)
+	}
+	if opts.featureSummary == "" {
+		return
+	}
+	if canonical {
+		writeFeatureVariants(opts.featureSummary, calls, opts.reference, opts.annotator)
+	} else {
+		writeFeatureMethylation(opts.featureSummary, vclr.SingleMoleculeSiteCalls(vca, threshold),
+			vclr.CallSingleMoleculeMethylation(vca, threshold), opts.annotator)
+	}
+}
+
+func printBackgroundHeader() {
+	fmt.Printf("\t%-10s\t%-10s\t%-10s\t%-10s", "bg_pct", "bg_n", "corrected", "bg_flag")
+}
+
+// printBackground corrects the site's percent methylated for the control background, the flag is high when the
+// background is above the maximum and none when the control doesn't have enough calls
+func printBackground(opts *siteReportOptions, site int, stats *vclr.SiteCallStats) {
+	bg, n := opts.background.Background(site)
+	flag := "ok"
+	if math.IsNaN(bg) {
+		flag = "none"
+	} else if bg > opts.maxBackground {
+		flag = "high"
 	}
+	fmt.Printf("\t%-10.4f\t%-10v\t%-10.4f\t%-10s", bg, n, opts.background.Correct(site, stats), flag)
+}
+
+// probAlphabet is the bases with a probability column, the modified bases are only called by methyl
+func probAlphabet(canonical bool) []string {
+	if canonical {
+		return []string{"A", "C", "G", "T"}
+	}
+	return []string{"A", "C", "G", "T", "I", "E"}
+}
+
+func printProbsHeader(canonical bool) {
+	for _, base := range probAlphabet(canonical) {
+		fmt.Printf("\tP(%v)    ", base)
+	}
+	fmt.Printf("\t%-10s\t%-6s\t%-10s", "entropy", "second", "second_prob")
+}
+
+func printProbs(probs map[string]float64, call string, canonical bool) {
+	for _, base := range probAlphabet(canonical) {
+		fmt.Printf("\t%-8.4f", probs[base])
+	}
+	second, secondProb := vclr.SecondBestProb(probs, call)
+	if second == "" {
+		second = "."
+	}
+	fmt.Printf("\t%-10.4f\t%-6s\t%-10.4f", vclr.ProbEntropy(probs), second, secondProb)
+}
+
+func printStrandBiasHeader() {
+	for _, label := range vclr.OrientationLabels {
+		fmt.Printf("\tn_%-10s", label)
+	}
+	for _, label := range vclr.OrientationLabels {
+		fmt.Printf("\tf_%-10s", label)
+	}
+	fmt.Printf("\t%-10s", "strand_p")
+}
+
+func printStrandBias(bias *vclr.StrandBias) {
+	for _, label := range vclr.OrientationLabels {
+		fmt.Printf("\t%-12v", bias.Reads[label])
+	}
+	for _, label := range vclr.OrientationLabels {
+		fmt.Printf("\t%-12.4f", bias.CallFraction(label))
+	}
+	fmt.Printf("\t%-10.4g", bias.PValue())
+}
+
+func printAnnotationHeader(annotator *vclr.Annotator) {
+	if annotator == nil {
+		return
+	}
+	fmt.Printf("\t%-15s\t%-15s\t%-10s", "gene", "feature_type", "tss_dist")
+}
+
+// printAnnotation adds the annotation columns for a site, if we're annotating
+func printAnnotation(annotator *vclr.Annotator, site int) {
+	if annotator == nil {
+		return
+	}
+	a := annotator.Annotate(site)
+	if a == nil {
+		fmt.Printf("\t%-15s\t%-15s\t%-10s", ".", ".", ".")
+		return
+	}
+	fmt.Printf("\t%-15s\t%-15s\t%-10v", a.Name, a.Type, a.TssDistance)
+}
+
+// writeFeatureMethylation writes the percent methylation for each gene to path
+func writeFeatureMethylation(path string, siteCalls map[int]*vclr.SiteCallStats, readCalls [][]*vclr.VariantCall,
+	annotator *vclr.Annotator) {
+	fH, ok := os.Create(path)
+	check(ok, fmt.Sprintf("Error creating file %v", path))
+	defer fH.Close()
+	summaries := vclr.FeatureMethylation(siteCalls, readCalls, annotator.Genes, 1)
+	fmt.Fprintf(fH, "%-20s\t%-10s\t%-10s\t%-8s\t%-10s\t%-10s\n", "Name", "Start", "End", "n_sites", "coverage",
+		"mean_p_Methyl")
+	for _, w := range summaries {
+		fmt.Fprintf(fH, "%-20s\t%-10v\t%-10v\t%-8v\t%-10v\t%-10.4f\n", w.Name, w.Start, w.End, w.NSites, w.Coverage,
+			w.MeanPercentMethylated())
+	}
+}
+
+// writeFeatureVariants writes the number of variant calls in each gene to path
+func writeFeatureVariants(path string, calls map[int]string, reference string, annotator *vclr.Annotator) {
+	if reference == "" {
+		panic("Need a reference (-r) to count variants per feature")
+	}
+	fH, ok := os.Create(path)
+	check(ok, fmt.Sprintf("Error creating file %v", path))
+	defer fH.Close()
+	summaries := vclr.FeatureVariantCounts(calls, reference, annotator.Genes)
+	fmt.Fprintf(fH, "%-20s\t%-10s\t%-10s\t%-8s\t%-10s\n", "Name", "Start", "End", "n_sites", "n_variants")
+	for _, fs := range summaries {
+		if fs.NSites == 0 {
+			continue
+		}
+		fmt.Fprintf(fH, "%-20s\t%-10v\t%-10v\t%-8v\t%-10v\n", fs.Feature.Name, fs.Feature.Start, fs.Feature.End-1,
+			fs.NSites, fs.NVariants)
+	}
+}
+
+// loadFeatures reads a GFF3 (.gff or .gff3) or BED file
+func loadFeatures(path string) []*vclr.Feature {
+	fH, ok := os.Open(path)
+	check(ok, fmt.Sprintf("Error opening file %v", path))
+	defer fH.Close()
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gff" || ext == ".gff3" {
+		return vclr.ParseGff3(fH)
+	}
+	return vclr.ParseBed(fH)
 }
 
 func check(ok error, msg string) {
@@ -221,72 +924,447 @@ func check(ok error, msg string) {
 	}
 }
 
-func main() {
-	tool := flag.String("tool", "smVariant", "Tool to use options are: \n\t" +
-		" single molecule variant: sm-variant\n\t" +
-		" single molecule methylation: sm-methyl\n\t" +
-		" variant call: variant\n\t" +
-		" site stats: sm-site-stats\n\t" +
-		" methylation call: methyl")
-	inDir := flag.String("d", "", "directory with files")
-	refFasta := flag.String("r", "", "reference location")
-	threshold := flag.Float64("t", 0.0, "threshold")
-	readScoreT := flag.Float64("s", 0.0, "readScore threshold")
-	strandFilter := flag.String("strand", "", "specify to use only one strand")
+// loadAlignments parses all of the files matching the glob, or stdin if the glob is empty
+func loadAlignments(glob string) *vclr.VcAlignment {
+	vca := vclr.VcAlignmentConstruct()
+	if glob == "" {
+		vclr.ParseAlignmentFile(bufio.NewReader(os.Stdin), vca)
+		return vca
+	}
+	files, err := filepath.Glob(glob)
+	check(err, "Problem reading directory")
+	for _, fp := range files {
+		fH, err := os.Open(fp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Problem with file %v\n", fp)
+			continue
+		}
+		vclr.ParseAlignmentFile(fH, vca)
+		fH.Close()
+	}
+	return vca
+}
 
-	flag.Parse()
+// loadThresholdPolicy uses defaultThreshold for everything when there isn't a threshold table
+func loadThresholdPolicy(path string, defaultThreshold float64) *vclr.ThresholdPolicy {
+	if path == "" {
+		return vclr.ThresholdPolicyConstruct(defaultThreshold)
+	}
+	fH, ok := os.Open(path)
+	check(ok, fmt.Sprintf("Error opening file %v", path))
+	defer fH.Close()
+	return vclr.ParseThresholdPolicy(fH, defaultThreshold)
+}
 
-	vca := vclr.VcAlignmentConstruct()
+// loadCalibration returns nil when there isn't a model
+func loadCalibration(path string) *vclr.Calibration {
+	if path == "" {
+		return nil
+	}
+	fH, ok := os.Open(path)
+	check(ok, fmt.Sprintf("Error opening file %v", path))
+	defer fH.Close()
+	return vclr.ParseCalibration(fH)
+}
 
-	if *inDir == "" {
-		vclr.ParseAlignmentFile(bufio.NewReader(os.Stdin), vca)
-	} else {
-		files, err := filepath.Glob(*inDir)
-		check(err, "Problem reading directory")
-		for _, fp := range files {
-			fH, err := os.Open(fp)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Problem with file %v\n", fp)
-				continue
-			}
-			vclr.ParseAlignmentFile(fH, vca)
-			fH.Close()
+// loadReference returns the name and sequence of the first record in the fasta
+func loadReference(refFasta string) (string, string) {
+	fH, ok := os.Open(refFasta)
+	check(ok, fmt.Sprintf("Error opening file %v", refFasta))
+	defer fH.Close()
+	fqr := vclr.FqReader{Reader: bufio.NewReader(fH)}
+	r, _ := fqr.Iter()
+	return r.Name, r.Seq
+}
+
+// parseFloatList parses a comma separated list of numbers, like "5,10,20"
+func parseFloatList(s string) []float64 {
+	values := make([]float64, 0)
+	if s == "" {
+		return values
+	}
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		check(err, fmt.Sprintf("Error parsing number %v in %v", field, s))
+		values = append(values, v)
+	}
+	return values
+}
+
+// parseRegion parses start-end, an empty region is everything
+func parseRegion(region string) (int, int) {
+	if region == "" {
+		return 0, -1
+	}
+	parts := strings.SplitN(region, "-", 2)
+	if len(parts) != 2 {
+		panic(fmt.Sprintf("Error, region %v should be start-end", region))
+	}
+	start, err := strconv.Atoi(parts[0])
+	check(err, fmt.Sprintf("Error parsing region %v", region))
+	end, err := strconv.Atoi(parts[1])
+	check(err, fmt.Sprintf("Error parsing region %v", region))
+	return start, end
+}
+
+// titrationSet is one line of the titration table, a label, the expected methylated fraction and an alignment glob
+type titrationSet struct {
+	label    string
+	fraction float64
+	glob     string
+}
+
+func parseTitrationTable(path string) []titrationSet {
+	fH, ok := os.Open(path)
+	check(ok, fmt.Sprintf("Error opening file %v", path))
+	defer fH.Close()
+	sets := make([]titrationSet, 0)
+	scanner := bufio.NewScanner(fH)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			panic(fmt.Sprintf("Error, titration line %v should be label, fraction and glob", line))
 		}
+		fraction, err := strconv.ParseFloat(fields[1], 64)
+		check(err, fmt.Sprintf("Error parsing fraction %v", fields[1]))
+		if fraction < 0 || fraction > 1 {
+			panic(fmt.Sprintf("Error, fraction %v should be between 0 and 1", fields[1]))
+		}
+		sets = append(sets, titrationSet{label: fields[0], fraction: fraction, glob: fields[2]})
 	}
+	return sets
+}
 
+// readScoreFilter is the -s option, either a threshold (0 is off) or auto to fit a mixture to each strand's read
+// scores and cut where a read is at least posterior likely to be good
+type readScoreFilter struct {
+	auto      bool
+	threshold float64
+	posterior float64
+}
+
+func parseReadScoreFilter(s string, posterior float64) *readScoreFilter {
+	if s == "auto" {
+		if posterior <= 0 || posterior >= 1 {
+			panic(fmt.Sprintf("Error, auto read score posterior %v should be between 0 and 1", posterior))
+		}
+		return &readScoreFilter{auto: true, threshold: 0.0, posterior: posterior}
+	}
+	threshold, err := strconv.ParseFloat(s, 64)
+	check(err, fmt.Sprintf("Error, read score threshold %v should be a number or auto", s))
+	return &readScoreFilter{auto: false, threshold: threshold, posterior: posterior}
+}
+
+// autoReadScoreCutoffs fits a mixture to each strand with enough reads and reports it, strands with too few reads
+// aren't filtered
+func autoReadScoreCutoffs(vca *vclr.VcAlignment, posterior float64) map[string]float64 {
+	cutoffs := make(map[string]float64)
+	for strand, scores := range vclr.ReadScoresByStrand(vca) {
+		if len(scores) < 10 {
+			fmt.Fprintf(os.Stderr, "strand %v: only %v reads, not fitting a read score mixture\n", strand,
+				len(scores))
+			continue
+		}
+		mixture := vclr.FitGaussianMixture(scores, 500)
+		cutoffs[strand] = mixture.Cutoff(posterior)
+		fmt.Fprintf(os.Stderr, "strand %v: %v\n", strand, mixture)
+		fmt.Fprintf(os.Stderr, "strand %v: read score cutoff %.4f at posterior %v\n", strand, cutoffs[strand],
+			posterior)
+	}
+	return cutoffs
+}
+
+// prepareAlignment applies the calibration, then the strand and read score filters
+func prepareAlignment(vca *vclr.VcAlignment, calibration *vclr.Calibration, strandFilter string,
+	readScore *readScoreFilter) *vclr.VcAlignment {
+	if calibration != nil {
+		vca.Recalibrate(calibration)
+	}
 	var alns *vclr.VcAlignment
-	if *strandFilter != "" {
+	if strandFilter != "" {
 		byStrand := vca.GroupByStrand()
-		_, check := byStrand[*strandFilter]
+		_, check := byStrand[strandFilter]
 		if !check {
-			err := fmt.Sprintf("Didn't find any reads for stand %v\n", *strandFilter)
+			err := fmt.Sprintf("Didn't find any reads for stand %v\n", strandFilter)
 			panic(err)
 		}
-		alns = byStrand[*strandFilter]
+		alns = byStrand[strandFilter]
 	} else {
 		alns = vca
 	}
 
-	if *readScoreT > 0.0 {
-		alns = alns.FilterByReadScore(*readScoreT)
+	if readScore.auto {
+		alns = alns.FilterByStrandReadScore(autoReadScoreCutoffs(alns, readScore.posterior))
+	} else if readScore.threshold > 0.0 {
+		alns = alns.FilterByReadScore(readScore.threshold)
+	}
+	return alns
+}
+
+func main() {
+	tool := flag.String("tool", "smVariant", "Tool to use options are: \n\t" +
+		" single molecule variant: sm-variant\n\t" +
+		" single molecule methylation: sm-methyl\n\t" +
+		" variant call: variant\n\t" +
+		" site stats: sm-site-stats\n\t" +
+		" methylation call: methyl\n\t" +
+		" differential methylation: diff-methyl\n\t" +
+		" benchmark against truth VCF: benchmark\n\t" +
+		" single molecule variant error profile: sm-variant-errors\n\t" +
+		" single molecule variant accuracy by k-mer: sm-variant-context\n\t" +
+		" single molecule methylation by k-mer: sm-methyl-context\n\t" +
+		" polished consensus fasta: consensus\n\t" +
+		" export single molecule calls: sm-export\n\t" +
+		" single molecule methylation per site: sm-methyl-sites\n\t" +
+		" methylation over windows or BED features: windows\n\t" +
+		" co-methylation between sites on the same read: co-methyl\n\t" +
+		" cluster reads by methylation or variant pattern: cluster-reads\n\t" +
+		" allele-specific methylation: allele-methyl\n\t" +
+		" read-backed phasing of variant sites: phase\n\t" +
+		" strain mixture proportions: strain-mix\n\t" +
+		" train a probability calibration model: calibrate\n\t" +
+		" methylation titration standard curve: titration\n\t" +
+		" read score vs accuracy or methylation: read-scores")
+	inDir := flag.String("d", "", "directory with files")
+	refFasta := flag.String("r", "", "reference location")
+	defaultThreshold := flag.Float64("t", 0.0, "threshold")
+	thresholdFile := flag.String("thresholds", "", "table of strand, base and threshold, * matches any, " +
+		"overrides -t for matching aligned pairs")
+	readScoreFlag := flag.String("s", "0", "readScore threshold, or auto to pick one per strand from a two " +
+		"component mixture fit to the read scores")
+	autoPosterior := flag.Float64("s-posterior", 0.5, "with -s auto, keep reads at least this likely to be " +
+		"from the good component")
+	calibrationFile := flag.String("calibration", "", "recalibrate aligned pair probabilities with this model " +
+		"from calibrate before anything else")
+	strandFilter := flag.String("strand", "", "specify to use only one strand")
+	llrCutoff := flag.Float64("llr", 0.0, "only call sites with |log(P(mod)/P(canonical))| above this, 0 is off " +
+		"(sm-methyl, sm-site-stats, diff-methyl)")
+	alpha := flag.Float64("alpha", 0.05, "confidence intervals are 1 - alpha (sm-site-stats, methyl, " +
+		"strain-mix)")
+	nBootstrap := flag.Int("bootstrap", 0, "number of bootstrap replicates over reads, 0 is off (sm-site-stats)")
+	seed := flag.Int64("seed", 1, "random seed")
+	annotationFile := flag.String("annotate", "", "GFF3 or BED file to annotate sites with (variant, methyl, " +
+		"sm-site-stats)")
+	featureSummary := flag.String("feature-summary", "", "write a per-gene summary table here, needs -annotate " +
+		"(variant, methyl, sm-site-stats)")
+	strandBias := flag.Bool("strand-bias", false, "add read counts and call fractions by strand and orientation " +
+		"and a strand bias p-value (variant, methyl)")
+	minStrandP := flag.Float64("min-strand-p", 0.0, "drop sites with a strand bias p-value below this, 0 is off " +
+		"(variant, methyl)")
+	fullProbs := flag.Bool("probs", false, "add the probability of each base, the entropy and the second best " +
+		"base (variant, methyl)")
+	maxDistance := flag.Int("max-dist", 100, "maximum distance between a pair of sites (co-methyl)")
+	minReads := flag.Int("min-reads", 1, "minimum number of informative reads (co-methyl)")
+	gatc := flag.Bool("gatc", false, "use the GATC motif caller for single molecule calls (co-methyl, " +
+		"cluster-reads)")
+	nClusters := flag.Int("clusters", 2, "number of clusters (cluster-reads)")
+	region := flag.String("region", "", "only use sites in start-end, inclusive (cluster-reads)")
+	clusterOn := flag.String("cluster-on", "methyl", "methyl or variant calls (cluster-reads)")
+	alleleSite := flag.Int("allele-site", -1, "variant site used to assign reads to alleles (allele-methyl)")
+	kmerSize := flag.Int("k", 5, "k-mer size for sequence context (sm-variant-context, sm-methyl-context)")
+	minCoverage := flag.Int("min-cov", 1, "minimum coverage to keep a call (consensus, phase) or calls at a " +
+		"site in a sample (titration)")
+	titrationFile := flag.String("titration", "", "table of label, expected methylated fraction and alignment " +
+		"glob for each sample (titration)")
+	minProb := flag.Float64("min-prob", 0.0, "minimum call probability to keep a call (consensus, allele-methyl, " +
+		"phase)")
+	maskMode := flag.String("mask", "N", "mark low confidence positions with N or lower (consensus)")
+	changeLog := flag.String("log", "", "file for the consensus change log, default stderr (consensus)")
+	sampleName := flag.String("sample", "sample", "sample name for the VCF (phase)")
+	readTable := flag.String("read-table", "", "file for the per-read table, default stderr (phase, strain-mix)")
+	strainFile := flag.String("strains", "", "strain-defining sites, a VCF with a sample per strain or a table " +
+		"of site, strain and base (strain-mix)")
+	calibrateOn := flag.String("calibrate-on", "reference", "truth for calibrate: reference (needs -r), or a " +
+		"modified or unmodified control")
+	calibrationMethod := flag.String("calibration-method", "isotonic", "isotonic or platt (calibrate)")
+	minPoints := flag.Int("min-points", 100, "minimum aligned pairs to fit a strand and base (calibrate)")
+	binWidth := flag.Float64("bin-width", 5.0, "read score bin width (read-scores)")
+	targetValue := flag.Float64("target", 95.0, "percent accuracy (with -r) or methylated to recommend a read " +
+		"score cutoff for (read-scores)")
+	exportFormat := flag.String("format", "fastq", "fastq or tsv (sm-export)")
+	controlDir := flag.String("control", "", "control alignment files (diff-methyl), or an unmethylated control " +
+		"to correct for background methylation (sm-site-stats, methyl)")
+	backgroundK := flag.Int("bg-k", 0, "pool the control background over sites with the same k-mer, 0 is " +
+		"per-site, needs -r (sm-site-stats, methyl)")
+	minBackgroundCalls := flag.Int("bg-min-calls", 5, "minimum control calls for a background, methyl uses the " +
+		"control's posteriors and sm-site-stats its hard calls (sm-site-stats, methyl)")
+	maxBackground := flag.Float64("max-background", 10.0, "flag sites with a control background above this " +
+		"percent (sm-site-stats, methyl)")
+	truthVcf := flag.String("truth", "", "truth VCF (benchmark)")
+	singleMolecule := flag.Bool("sm", false, "benchmark single molecule calls instead of site calls (benchmark)")
+	coverageBins := flag.String("cov-bins", "5,10,20,50", "coverage strata edges (benchmark)")
+	probBins := flag.String("prob-bins", "0.5,0.7,0.9,0.99", "call probability strata edges (benchmark)")
+	window := flag.Int("window", 0, "aggregate sites into windows of this size, 0 is per-site (diff-methyl, windows)")
+	step := flag.Int("step", 0, "window step, 0 is the window size (windows)")
+	minSites := flag.Int("min-sites", 1, "minimum number of sites in a window (windows) or called sites per read " +
+		"(cluster-reads, strain-mix)")
+	bedFile := flag.String("bed", "", "aggregate over the features in this BED or GFF3 file instead of windows " +
+		"(windows)")
+
+	flag.Parse()
+
+	calibration := loadCalibration(*calibrationFile)
+	readScore := parseReadScoreFilter(*readScoreFlag, *autoPosterior)
+	// titration loads its own alignment sets
+	var alns *vclr.VcAlignment
+	if *tool != "titration" {
+		alns = prepareAlignment(loadAlignments(*inDir), calibration, *strandFilter, readScore)
+	}
+	threshold := loadThresholdPolicy(*thresholdFile, *defaultThreshold)
+
+	siteOpts := &siteReportOptions{llrCutoff: *llrCutoff, alpha: *alpha, nBootstrap: *nBootstrap, seed: *seed,
+		annotator: nil, featureSummary: *featureSummary, reference: "", strandBias: *strandBias,
+		minStrandP: *minStrandP, fullProbs: *fullProbs, background: nil, maxBackground: *maxBackground}
+	if *annotationFile != "" {
+		siteOpts.annotator = vclr.AnnotatorConstruct(loadFeatures(*annotationFile))
+	} else if *featureSummary != "" {
+		panic("-feature-summary needs features, use -annotate")
+	}
+	if *refFasta != "" && *tool == "variant" {
+		_, siteOpts.reference = loadReference(*refFasta)
+	}
+	if *controlDir != "" && (*tool == "sm-site-stats" || *tool == "methyl") {
+		controlAlns := prepareAlignment(loadAlignments(*controlDir), calibration, *strandFilter, readScore)
+		reference := ""
+		if *backgroundK > 0 {
+			_, reference = loadReference(*refFasta)
+		}
+		// sm-site-stats reports hard calls and methyl the posterior, the background has to match
+		siteOpts.background = vclr.BackgroundModelConstruct(singleMoleculeCallStats(controlAlns, threshold,
+			*llrCutoff), reference, *backgroundK, *minBackgroundCalls, *tool == "methyl")
 	}
 
 	if *tool == "sm-variant" {
-		fH, ok := os.Open(*refFasta)
-		check(ok, fmt.Sprintf("Error opening file %v", *refFasta))
-		defer fH.Close()
-		fqr := vclr.FqReader{Reader: bufio.NewReader(fH)}
-		r, _ := fqr.Iter()
-		callSingleStrandVariants(alns, threshold, r.Seq)
+		_, reference := loadReference(*refFasta)
+		callSingleStrandVariants(alns, threshold, reference)
+	} else if *tool == "sm-variant-errors" {
+		_, reference := loadReference(*refFasta)
+		singleStrandErrorProfile(alns, threshold, reference)
+	} else if *tool == "sm-variant-context" {
+		_, reference := loadReference(*refFasta)
+		variantContexts(alns, threshold, reference, *kmerSize)
+	} else if *tool == "sm-methyl-context" {
+		_, reference := loadReference(*refFasta)
+		methylationContexts(alns, threshold, reference, *kmerSize)
+	} else if *tool == "sm-export" {
+		if *exportFormat != "fastq" && *exportFormat != "tsv" {
+			panic(fmt.Sprintf("Error, format %v not recognised, use fastq or tsv", *exportFormat))
+		}
+		exportSingleMoleculeCalls(alns, threshold, *exportFormat == "fastq")
 	} else if *tool == "sm-methyl" {
-		callSingleStrandMethylation(alns, threshold)
+		callSingleStrandMethylation(alns, threshold, *llrCutoff)
+	} else if *tool == "sm-methyl-sites" {
+		singleMoleculeMethylationSites(alns, threshold)
+	} else if *tool == "windows" {
+		var features []*vclr.Feature
+		if *bedFile != "" {
+			features = loadFeatures(*bedFile)
+		} else if *window < 1 {
+			panic("windows needs a window size (-window) or a BED file (-bed)")
+		}
+		if *step < 1 {
+			*step = *window
+		}
+		methylationWindows(alns, threshold, features, *window, *step, *minSites)
+	} else if *tool == "co-methyl" {
+		coMethylation(alns, threshold, *gatc, *maxDistance, *minReads)
+	} else if *tool == "cluster-reads" {
+		if *clusterOn != "methyl" && *clusterOn != "variant" {
+			panic(fmt.Sprintf("Error, cluster-on %v not recognised, use methyl or variant", *clusterOn))
+		}
+		start, end := parseRegion(*region)
+		clusterReads(alns, threshold, *clusterOn == "methyl", *gatc, start, end, *nClusters, *minSites, *seed)
+	} else if *tool == "allele-methyl" {
+		if *alleleSite < 0 {
+			panic("allele-methyl needs a variant site, use -allele-site")
+		}
+		alleleSpecificMethylation(alns, threshold, *alleleSite, *minProb, *llrCutoff)
 	} else if *tool == "sm-site-stats" {
-		singleMoleculeSiteStats(alns, threshold)
+		singleMoleculeSiteStats(alns, threshold, siteOpts)
+	} else if *tool == "diff-methyl" {
+		if *controlDir == "" {
+			panic("diff-methyl needs control alignments, use -control")
+		}
+		controlAlns := prepareAlignment(loadAlignments(*controlDir), calibration, *strandFilter, readScore)
+		differentialMethylation(alns, controlAlns, threshold, *llrCutoff, *window)
+	} else if *tool == "benchmark" {
+		_, reference := loadReference(*refFasta)
+		fH, ok := os.Open(*truthVcf)
+		check(ok, fmt.Sprintf("Error opening file %v", *truthVcf))
+		_, records := vclr.ParseVcf(fH)
+		fH.Close()
+		benchmarkCalls(alns, threshold, reference, vclr.TruthSnvs(records), *singleMolecule,
+			parseFloatList(*coverageBins), parseFloatList(*probBins))
+	} else if *tool == "consensus" {
+		name, reference := loadReference(*refFasta)
+		if *maskMode != "N" && *maskMode != "lower" {
+			panic(fmt.Sprintf("Error, mask %v not recognised, use N or lower", *maskMode))
+		}
+		logFh := os.Stderr
+		if *changeLog != "" {
+			fH, ok := os.Create(*changeLog)
+			check(ok, fmt.Sprintf("Error creating file %v", *changeLog))
+			defer fH.Close()
+			logFh = fH
+		}
+		polishReference(alns, threshold, name, reference, *minCoverage, *minProb, *maskMode == "lower", logFh)
+	} else if *tool == "phase" {
+		name, reference := loadReference(*refFasta)
+		tableFh := os.Stderr
+		if *readTable != "" {
+			fH, ok := os.Create(*readTable)
+			check(ok, fmt.Sprintf("Error creating file %v", *readTable))
+			defer fH.Close()
+			tableFh = fH
+		}
+		phaseVariants(alns, threshold, name, reference, *sampleName, *minCoverage, *minProb, tableFh)
+	} else if *tool == "strain-mix" {
+		if *strainFile == "" {
+			panic("strain-mix needs strain-defining sites, use -strains")
+		}
+		tableFh := os.Stderr
+		if *readTable != "" {
+			fH, ok := os.Create(*readTable)
+			check(ok, fmt.Sprintf("Error creating file %v", *readTable))
+			defer fH.Close()
+			tableFh = fH
+		}
+		strainMixture(alns, threshold, loadStrainProfile(*strainFile), *minSites, *alpha, tableFh)
+	} else if *tool == "calibrate" {
+		if *calibrateOn != "reference" && *calibrateOn != "modified" && *calibrateOn != "unmodified" {
+			panic(fmt.Sprintf("Error, calibrate-on %v not recognised, use reference, modified or unmodified",
+				*calibrateOn))
+		}
+		if *calibrationMethod != vclr.IsotonicCalibration && *calibrationMethod != vclr.PlattCalibration {
+			panic(fmt.Sprintf("Error, calibration-method %v not recognised, use isotonic or platt",
+				*calibrationMethod))
+		}
+		reference := ""
+		if *calibrateOn == "reference" {
+			_, reference = loadReference(*refFasta)
+		}
+		trainCalibration(alns, *calibrateOn, reference, *calibrationMethod, *minPoints)
+	} else if *tool == "titration" {
+		if *titrationFile == "" {
+			panic("titration needs a table of samples, use -titration")
+		}
+		titration(parseTitrationTable(*titrationFile), calibration, threshold, *strandFilter, readScore,
+			*llrCutoff, *minCoverage)
+	} else if *tool == "read-scores" {
+		reference := ""
+		if *refFasta != "" {
+			_, reference = loadReference(*refFasta)
+		}
+		readScoreReport(alns, threshold, reference, *binWidth, *targetValue)
 	} else {
 		if *tool == "variant" {
-			callSites(alns, threshold, true)
+			callSites(alns, threshold, true, siteOpts)
 		} else if *tool == "methyl" {
-			callSites(alns, threshold, false)
+			callSites(alns, threshold, false, siteOpts)
 		} else {
 			err := fmt.Sprintf("Error, tool %v not recognised", *tool)
 			panic(err)
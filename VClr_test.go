@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	vclr "github.com/ArtRand/VClr/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSingleStrandMethylationAmbiguousRead(t *testing.T) {
+	vca := vclr.VcAlignmentConstruct()
+	vclr.ParseAlignmentFile(strings.NewReader(
+		"ref\t5\tI\t0.95\tt\tforward\tr1\n" +
+		"ref\t5\tI\t0.9\tt\tforward\tr2\n" +
+		"ref\t10\tC\t0.7\tt\tforward\tr2\n" +
+		// r3 only has an ambiguous call
+		"ref\t5\tI\t0.5\tt\tforward\tr3\n" +
+		"ref\t5\tC\t0.5\tt\tforward\tr3\n"), vca)
+	var out bytes.Buffer
+	template, complement := singleStrandMethylation(vca, vclr.ThresholdPolicyConstruct(0.0), 1.0, &out)
+
+	assert.True(t, len(template.percents) == 2 && len(template.scores) == 2)
+	assert.True(t, len(complement.percents) == 0)
+	mean, median, pearsons := template.summary()
+	for _, v := range []float64{mean, median, pearsons} {
+		assert.False(t, math.IsNaN(v))
+	}
+	assert.InDelta(t, 75.0, mean, 1e-9)
+	// the ambiguous read still gets a row with its ambiguous count
+	assert.True(t, strings.Contains(out.String(), "r3\tNaN\tNaN\t50\tNaN\t1\t0\n"), "got %v", out.String())
+}
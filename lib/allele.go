@@ -0,0 +1,67 @@
+package VClr
+
+import (
+	"sort"
+)
+
+// AssignReadsToAlleles calls each read at site with CallSiteOnCodingStrand and returns a map of reads to the
+// allele they carry, reads without a call or with a call probability below minProb aren't assigned
+func AssignReadsToAlleles(alignment *VcAlignment, site int, threshold *ThresholdPolicy,
+	minProb float64) map[string]string {
+	assignments := make(map[string]string)
+	siteAln, check := alignment.GroupBySite()[site]
+	if !check {
+		return assignments
+	}
+	for readLabel, readAln := range siteAln.GroupByRead() {
+		call, prob := readAln.CallSiteOnCodingStrand(threshold)
+		if call == "" || prob < minProb {
+			continue
+		}
+		assignments[readLabel] = call
+	}
+	return assignments
+}
+
+// AlleleCount is the number of reads assigned to an allele
+type AlleleCount struct {
+	Allele string
+	NReads int
+}
+
+// CountAlleles counts the reads assigned to each allele, most common first
+func CountAlleles(assignments map[string]string) []*AlleleCount {
+	counts := make(map[string]int)
+	for _, allele := range assignments {
+		counts[allele] += 1
+	}
+	alleles := make([]*AlleleCount, 0, len(counts))
+	for allele, n := range counts {
+		alleles = append(alleles, &AlleleCount{Allele: allele, NReads: n})
+	}
+	sort.Slice(alleles, func(i, j int) bool {
+		if alleles[i].NReads != alleles[j].NReads {
+			return alleles[i].NReads > alleles[j].NReads
+		}
+		return alleles[i].Allele < alleles[j].Allele
+	})
+	return alleles
+}
+
+// AlleleAlignments splits the alignment by the allele each read was assigned to, the variant site itself is
+// left out because it isn't a methylation site
+func AlleleAlignments(alignment *VcAlignment, assignments map[string]string, variantSite int) map[string]*VcAlignment {
+	byAllele := make(map[string]*VcAlignment)
+	for _, r := range alignment.Records {
+		allele, assigned := assignments[r.readLabel]
+		if !assigned || r.refPos == variantSite {
+			continue
+		}
+		_, check := byAllele[allele]
+		if !check {
+			byAllele[allele] = VcAlignmentConstruct()
+		}
+		byAllele[allele].AddRecord(r)
+	}
+	return byAllele
+}
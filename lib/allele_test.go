@@ -0,0 +1,38 @@
+package VClr
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlleleSpecificMethylation(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t10\tC\t0.9\tt\tforward\tr1\n" +
+		"ref\t20\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t10\tC\t0.8\tt\tforward\tr2\n" +
+		"ref\t20\tI\t0.9\tt\tforward\tr2\n" +
+		"ref\t10\tC\t0.9\tt\tforward\tr3\n" +
+		"ref\t20\tI\t0.9\tt\tforward\tr3\n" +
+		"ref\t10\tT\t0.9\tt\tforward\tr4\n" +
+		"ref\t20\tA\t0.9\tt\tforward\tr4\n" +
+		"ref\t10\tT\t0.9\tt\tforward\tr5\n" +
+		"ref\t20\tA\t0.9\tt\tforward\tr5\n" +
+		"ref\t10\tG\t0.3\tt\tforward\tr6\n" +
+		"ref\t20\tA\t0.9\tt\tforward\tr6\n")
+	assignments := AssignReadsToAlleles(vca, 10, ThresholdPolicyConstruct(0.0), 0.5)
+	assert.True(t, len(assignments) == 6)
+	assignments = AssignReadsToAlleles(vca, 10, ThresholdPolicyConstruct(0.5), 0.0)
+	// r6 has no aligned pairs above the threshold
+	assert.True(t, len(assignments) == 5)
+	alleles := CountAlleles(assignments)
+	assert.True(t, alleles[0].Allele == "C" && alleles[0].NReads == 3)
+	assert.True(t, alleles[1].Allele == "T" && alleles[1].NReads == 2)
+
+	byAllele := AlleleAlignments(vca, assignments, 10)
+	assert.True(t, len(byAllele["C"].Records) == 3 && len(byAllele["T"].Records) == 2)
+	results := DifferentialMethylation(SingleMoleculeSiteCalls(byAllele["C"], ThresholdPolicyConstruct(0.0)),
+		SingleMoleculeSiteCalls(byAllele["T"], ThresholdPolicyConstruct(0.0)), 0)
+	assert.True(t, len(results) == 1 && results[0].Start == 20)
+	assert.InDelta(t, 100.0, results[0].DeltaPercentMethylated(), 1e-9)
+	assert.InDelta(t, 0.1, results[0].PValue, 1e-9)
+}
@@ -0,0 +1,135 @@
+package VClr
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// SiteAnnotation describes the features around a site. Name is the overlapping gene (or the nearest one when Distance
+// is greater than 0), Type lists the types of all overlapping features ("intergenic" if there are none) and
+// TssDistance is the distance from the nearest transcription start site in the direction of transcription, so
+// negative values are upstream
+type SiteAnnotation struct {
+	Name        string
+	Type        string
+	Distance    int
+	TssDistance int
+}
+
+// Annotator annotates sites against a set of features. If any of the features have type "gene" those are used for
+// names and TSSs, otherwise every feature is
+type Annotator struct {
+	all         *FeatureIndex
+	genes       *FeatureIndex
+	tss         []int
+	tssFeatures []*Feature
+	Genes       []*Feature
+}
+
+func AnnotatorConstruct(features []*Feature) *Annotator {
+	genes := make([]*Feature, 0)
+	for _, f := range features {
+		if f.Type == "gene" {
+			genes = append(genes, f)
+		}
+	}
+	if len(genes) == 0 {
+		genes = features
+	}
+	tssFeatures := make([]*Feature, len(genes))
+	copy(tssFeatures, genes)
+	sort.Slice(tssFeatures, func(i, j int) bool { return featureTss(tssFeatures[i]) < featureTss(tssFeatures[j]) })
+	tss := make([]int, len(tssFeatures))
+	for i, f := range tssFeatures {
+		tss[i] = featureTss(f)
+	}
+	return &Annotator{all: FeatureIndexConstruct(features), genes: FeatureIndexConstruct(genes), tss: tss,
+		tssFeatures: tssFeatures, Genes: genes}
+}
+
+// featureTss is the first base of the feature in the direction of transcription
+func featureTss(f *Feature) int {
+	if f.Strand == "-" {
+		return f.End - 1
+	}
+	return f.Start
+}
+
+// nearestTss returns the signed distance of pos from the closest TSS
+func (self *Annotator) nearestTss(pos int) int {
+	i := sort.SearchInts(self.tss, pos)
+	best := -1
+	bestDistance := math.MaxInt64
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(self.tss) {
+			continue
+		}
+		d := pos - self.tss[j]
+		if d < 0 {
+			d = -d
+		}
+		if d < bestDistance {
+			bestDistance = d
+			best = j
+		}
+	}
+	f := self.tssFeatures[best]
+	if f.Strand == "-" {
+		return self.tss[best] - pos
+	}
+	return pos - self.tss[best]
+}
+
+// Annotate returns nil when there are no features
+func (self *Annotator) Annotate(pos int) *SiteAnnotation {
+	gene, distance := self.genes.Nearest(pos)
+	if gene == nil {
+		return nil
+	}
+	types := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, f := range self.all.Overlapping(pos) {
+		if !seen[f.Type] {
+			seen[f.Type] = true
+			types = append(types, f.Type)
+		}
+	}
+	featureType := "intergenic"
+	if len(types) > 0 {
+		featureType = strings.Join(types, ",")
+	}
+	return &SiteAnnotation{Name: gene.Name, Type: featureType, Distance: distance, TssDistance: self.nearestTss(pos)}
+}
+
+// FeatureVariantSummary counts the called sites in a feature and how many of them differ from the reference
+type FeatureVariantSummary struct {
+	Feature   *Feature
+	NSites    int
+	NVariants int
+}
+
+// FeatureVariantCounts summarizes site calls (like the ones from CallSite) over features, sites without a call are
+// skipped
+func FeatureVariantCounts(calls map[int]string, reference string, features []*Feature) []*FeatureVariantSummary {
+	summaries := make([]*FeatureVariantSummary, len(features))
+	summaryIdx := make(map[*Feature]int)
+	for i, f := range features {
+		summaries[i] = &FeatureVariantSummary{Feature: f, NSites: 0, NVariants: 0}
+		summaryIdx[f] = i
+	}
+	index := FeatureIndexConstruct(features)
+	for site, call := range calls {
+		if call == "" || site < 0 || site >= len(reference) {
+			continue
+		}
+		isVariant := call != strings.ToUpper(string(reference[site]))
+		for _, f := range index.Overlapping(site) {
+			summaries[summaryIdx[f]].NSites += 1
+			if isVariant {
+				summaries[summaryIdx[f]].NVariants += 1
+			}
+		}
+	}
+	return summaries
+}
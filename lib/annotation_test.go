@@ -0,0 +1,55 @@
+package VClr
+
+import (
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func annotationTestFeatures() []*Feature {
+	gff := "##gff-version 3\n" +
+		"ref\tsrc\tgene\t11\t20\t.\t+\t.\tID=gene0;Name=dam\n" +
+		"ref\tsrc\tCDS\t11\t20\t.\t+\t0\tID=cds0;Parent=gene0\n" +
+		"ref\tsrc\tgene\t41\t50\t.\t-\t.\tID=gene1;locus_tag=b0001\n" +
+		"##FASTA\n" +
+		">ref\nACGT\n"
+	return ParseGff3(strings.NewReader(gff))
+}
+
+func TestParseGff3(t *testing.T) {
+	features := annotationTestFeatures()
+	assert.True(t, len(features) == 3)
+	assert.True(t, features[0].Start == 10 && features[0].End == 20 && features[0].Name == "dam")
+	assert.True(t, features[1].Type == "CDS" && features[1].Name == "cds0")
+	assert.True(t, features[2].Name == "b0001" && features[2].Strand == "-")
+}
+
+func TestAnnotator_Annotate(t *testing.T) {
+	annotator := AnnotatorConstruct(annotationTestFeatures())
+	assert.True(t, len(annotator.Genes) == 2)
+
+	a := annotator.Annotate(12)
+	assert.Equal(t, "dam", a.Name)
+	assert.Equal(t, "gene,CDS", a.Type)
+	assert.True(t, a.Distance == 0 && a.TssDistance == 2)
+
+	// upstream of dam
+	a = annotator.Annotate(7)
+	assert.Equal(t, "intergenic", a.Type)
+	assert.True(t, a.Name == "dam" && a.Distance == 3 && a.TssDistance == -3)
+
+	// b0001 is on the minus strand so its TSS is at 49 and 52 is upstream of it
+	a = annotator.Annotate(52)
+	assert.True(t, a.Name == "b0001" && a.Distance == 3 && a.TssDistance == -3)
+	// 30 is closer to the start of b0001 than the end of dam, and 19 downstream of its TSS
+	a = annotator.Annotate(30)
+	assert.True(t, a.Name == "b0001" && a.Distance == 10 && a.TssDistance == 19)
+}
+
+func TestFeatureVariantCounts(t *testing.T) {
+	reference := strings.Repeat("A", 60)
+	calls := map[int]string{12: "A", 13: "C", 14: "", 45: "G", 30: "T"}
+	summaries := FeatureVariantCounts(calls, reference, AnnotatorConstruct(annotationTestFeatures()).Genes)
+	assert.True(t, summaries[0].NSites == 2 && summaries[0].NVariants == 1)
+	assert.True(t, summaries[1].NSites == 1 && summaries[1].NVariants == 1)
+}
@@ -0,0 +1,85 @@
+package VClr
+
+import "math"
+
+// BackgroundModel has the false-positive methylation from an unmethylated control, either per site or pooled over
+// the sites that share a reference k-mer (so sites without control coverage can still be corrected). When Posterior
+// is true the background and the corrected estimate are PosteriorPercentMethylated, otherwise they are
+// PercentMethylatedCalls
+type BackgroundModel struct {
+	Sites     map[int]*SiteCallStats
+	Kmers     map[string]*SiteCallStats
+	Posterior bool
+	reference string
+	k         int
+	minCalls  int
+}
+
+// BackgroundModelConstruct pools the control calls by the k-mer centered on each site (read on the reference
+// strand), k of 0 keeps them per site. Backgrounds from fewer than minCalls calls (or reads with a posterior) aren't
+// used
+func BackgroundModelConstruct(controlCalls map[int]*SiteCallStats, reference string, k, minCalls int,
+	posterior bool) *BackgroundModel {
+	model := &BackgroundModel{Sites: controlCalls, Kmers: nil, Posterior: posterior, reference: reference, k: k,
+		minCalls: minCalls}
+	if k < 1 {
+		return model
+	}
+	model.Kmers = make(map[string]*SiteCallStats)
+	for site, stats := range controlCalls {
+		kmer := KmerContext(reference, site, k, "t", true)
+		if kmer == "" {
+			continue
+		}
+		_, check := model.Kmers[kmer]
+		if !check {
+			model.Kmers[kmer] = SiteCallStatsConstruct()
+		}
+		model.Kmers[kmer].Merge(stats)
+	}
+	return model
+}
+
+// estimate is the percent methylated at a site and the number of calls (or posteriors) it comes from
+func (self *BackgroundModel) estimate(stats *SiteCallStats) (float64, int) {
+	if self.Posterior {
+		return stats.PosteriorPercentMethylated(), stats.NumberOfPosteriors()
+	}
+	return stats.PercentMethylatedCalls(), stats.NumberOfCalls()
+}
+
+// Background is the percent methylated in the control for site and the number of calls it comes from, NaN when
+// there are fewer than minCalls
+func (self *BackgroundModel) Background(site int) (float64, int) {
+	var stats *SiteCallStats
+	if self.Kmers != nil {
+		stats = self.Kmers[KmerContext(self.reference, site, self.k, "t", true)]
+	} else {
+		stats = self.Sites[site]
+	}
+	if stats == nil {
+		return math.NaN(), 0
+	}
+	bg, n := self.estimate(stats)
+	if n < self.minCalls || n == 0 {
+		return math.NaN(), 0
+	}
+	return bg, n
+}
+
+// Correct is the sample's estimate at site (the same estimator as the background) with the background removed
+func (self *BackgroundModel) Correct(site int, stats *SiteCallStats) float64 {
+	bg, _ := self.Background(site)
+	observed, _ := self.estimate(stats)
+	return CorrectForBackground(observed, bg)
+}
+
+// CorrectForBackground removes a background false-positive rate from an observed percent methylated,
+// (observed - background) / (100 - background), clamped to 0-100. NaN when the background is 100
+func CorrectForBackground(observed, background float64) float64 {
+	if background >= 100 {
+		return math.NaN()
+	}
+	corrected := 100 * (observed - background) / (100 - background)
+	return math.Min(100, math.Max(0, corrected))
+}
@@ -0,0 +1,77 @@
+package VClr
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackgroundModel(t *testing.T) {
+	reference := "AAAAGATCAAAAAGATCAAAACCCAA"
+	control := alignmentFromString(
+		"ref\t5\tI\t0.9\tt\tforward\tc1\n" +
+		"ref\t5\tA\t0.9\tt\tforward\tc2\n" +
+		"ref\t5\tA\t0.9\tt\tforward\tc3\n" +
+		"ref\t5\tA\t0.9\tt\tforward\tc4\n" +
+		"ref\t22\tA\t0.9\tt\tforward\tc1\n")
+	controlCalls := SingleMoleculeSiteCalls(control, ThresholdPolicyConstruct(0.0))
+
+	perSite := BackgroundModelConstruct(controlCalls, reference, 0, 2, false)
+	bg, n := perSite.Background(5)
+	assert.InDelta(t, 25.0, bg, 1e-9)
+	assert.True(t, n == 4)
+	// too few calls at 22 and no control calls at 14
+	bg, _ = perSite.Background(22)
+	assert.True(t, math.IsNaN(bg))
+	bg, _ = perSite.Background(14)
+	assert.True(t, math.IsNaN(bg))
+
+	// 5 and 14 are both the A in GAT
+	perKmer := BackgroundModelConstruct(controlCalls, reference, 3, 2, false)
+	bg, n = perKmer.Background(14)
+	assert.InDelta(t, 25.0, bg, 1e-9)
+	assert.True(t, n == 4)
+
+	assert.InDelta(t, 60.0, CorrectForBackground(70.0, 25.0), 1e-9)
+	assert.InDelta(t, 0.0, CorrectForBackground(10.0, 25.0), 1e-9)
+	assert.True(t, math.IsNaN(CorrectForBackground(50.0, 100.0)))
+}
+
+// sm-site-stats corrects hard calls with a hard-call background and methyl corrects the posterior with a posterior
+// background, the control and sample here give different answers for the two
+func TestBackgroundModelEstimator(t *testing.T) {
+	threshold := ThresholdPolicyConstruct(0.0)
+	control := alignmentFromString(
+		"ref\t5\tI\t0.6\tt\tforward\tc1\n" +
+		"ref\t5\tA\t0.4\tt\tforward\tc1\n" +
+		"ref\t5\tI\t0.6\tt\tforward\tc2\n" +
+		"ref\t5\tA\t0.4\tt\tforward\tc2\n" +
+		"ref\t5\tI\t0.1\tt\tforward\tc3\n" +
+		"ref\t5\tA\t0.9\tt\tforward\tc3\n" +
+		"ref\t5\tI\t0.1\tt\tforward\tc4\n" +
+		"ref\t5\tA\t0.9\tt\tforward\tc4\n")
+	sample := SiteMethylationStats(alignmentFromString(
+		"ref\t5\tI\t0.9\tt\tforward\ts1\n" +
+		"ref\t5\tA\t0.1\tt\tforward\ts1\n" +
+		"ref\t5\tI\t0.9\tt\tforward\ts2\n" +
+		"ref\t5\tA\t0.1\tt\tforward\ts2\n" +
+		"ref\t5\tI\t0.2\tt\tforward\ts3\n" +
+		"ref\t5\tA\t0.8\tt\tforward\ts3\n" +
+		"ref\t5\tI\t0.2\tt\tforward\ts4\n" +
+		"ref\t5\tA\t0.8\tt\tforward\ts4\n"), threshold)
+
+	// 2 of 4 control reads are called methylated, the mean posterior is 35%
+	hardCalls := BackgroundModelConstruct(SingleMoleculeSiteCalls(control, threshold), "", 0, 2, false)
+	bg, n := hardCalls.Background(5)
+	assert.InDelta(t, 50.0, bg, 1e-9)
+	assert.True(t, n == 4)
+	// the sample is also 50% by hard calls, so nothing is left after the correction
+	assert.InDelta(t, 0.0, hardCalls.Correct(5, sample), 1e-9)
+
+	posterior := BackgroundModelConstruct(SingleMoleculeSiteCalls(control, threshold), "", 0, 2, true)
+	bg, n = posterior.Background(5)
+	assert.InDelta(t, 35.0, bg, 1e-9)
+	assert.True(t, n == 4)
+	// the sample's mean posterior is 55%
+	assert.InDelta(t, 100.0*(55.0-35.0)/(100.0-35.0), posterior.Correct(5, sample), 1e-9)
+}
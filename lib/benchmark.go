@@ -0,0 +1,180 @@
+package VClr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// BenchmarkCounts tallies variant calls against a truth set
+type BenchmarkCounts struct {
+	TP int
+	FP int
+	FN int
+	TN int
+}
+
+func BenchmarkCountsConstruct() *BenchmarkCounts {
+	return &BenchmarkCounts{TP: 0, FP: 0, FN: 0, TN: 0}
+}
+
+// AddCall classifies a call given the reference base and the true base (which is the reference base when there is
+// no variant at the site). Calling the wrong alternate base counts as both a FP and a FN, and a missing call ("") at
+// a variant site is a FN
+func (self *BenchmarkCounts) AddCall(call, refBase, truthBase string) {
+	isVariant := truthBase != refBase
+	switch {
+	case call == "":
+		if isVariant {
+			self.FN += 1
+		}
+	case call != refBase:
+		if call == truthBase {
+			self.TP += 1
+		} else {
+			self.FP += 1
+			if isVariant {
+				self.FN += 1
+			}
+		}
+	default:
+		if isVariant {
+			self.FN += 1
+		} else {
+			self.TN += 1
+		}
+	}
+}
+
+func (self *BenchmarkCounts) Merge(other *BenchmarkCounts) {
+	self.TP += other.TP
+	self.FP += other.FP
+	self.FN += other.FN
+	self.TN += other.TN
+}
+
+func (self *BenchmarkCounts) Precision() float64 {
+	return float64(self.TP) / float64(self.TP+self.FP)
+}
+
+func (self *BenchmarkCounts) Recall() float64 {
+	return float64(self.TP) / float64(self.TP+self.FN)
+}
+
+func (self *BenchmarkCounts) F1() float64 {
+	return float64(2*self.TP) / float64(2*self.TP+self.FP+self.FN)
+}
+
+// Strata bins values by a sorted list of edges, bin i holds values in [Edges[i-1], Edges[i])
+type Strata struct {
+	Edges  []float64
+	Counts []*BenchmarkCounts
+}
+
+func StrataConstruct(edges []float64) *Strata {
+	counts := make([]*BenchmarkCounts, len(edges)+1)
+	for i := range counts {
+		counts[i] = BenchmarkCountsConstruct()
+	}
+	return &Strata{Edges: edges, Counts: counts}
+}
+
+func (self *Strata) binIndex(value float64) int {
+	for i, e := range self.Edges {
+		if value < e {
+			return i
+		}
+	}
+	return len(self.Edges)
+}
+
+// Bin returns the counts for the stratum value falls into
+func (self *Strata) Bin(value float64) *BenchmarkCounts {
+	return self.Counts[self.binIndex(value)]
+}
+
+// Label is a printable interval for bin i
+func (self *Strata) Label(i int) string {
+	lo := math.Inf(-1)
+	hi := math.Inf(1)
+	if i > 0 {
+		lo = self.Edges[i-1]
+	}
+	if i < len(self.Edges) {
+		hi = self.Edges[i]
+	}
+	return strings.Replace(fmt.Sprintf("[%v,%v)", lo, hi), "Inf", "inf", -1)
+}
+
+// BenchmarkReport has the per-site, aggregate and stratified counts for a set of calls
+type BenchmarkReport struct {
+	Sites      map[int]*BenchmarkCounts
+	Total      *BenchmarkCounts
+	ByCoverage *Strata
+	ByProb     *Strata
+}
+
+func BenchmarkReportConstruct(coverageEdges, probEdges []float64) *BenchmarkReport {
+	return &BenchmarkReport{Sites: make(map[int]*BenchmarkCounts), Total: BenchmarkCountsConstruct(),
+		ByCoverage: StrataConstruct(coverageEdges), ByProb: StrataConstruct(probEdges)}
+}
+
+func (self *BenchmarkReport) addCall(site int, call string, coverage int, prob float64, reference string,
+	truth map[int]string) {
+	if site < 0 || site >= len(reference) {
+		err := fmt.Sprintf("BenchmarkReport: site %v is outside of the reference", site)
+		panic(err)
+	}
+	refBase := strings.ToUpper(string(reference[site]))
+	truthBase, isVariant := truth[site]
+	if !isVariant {
+		truthBase = refBase
+	}
+	_, check := self.Sites[site]
+	if !check {
+		self.Sites[site] = BenchmarkCountsConstruct()
+	}
+	self.Sites[site].AddCall(call, refBase, truthBase)
+	self.Total.AddCall(call, refBase, truthBase)
+	self.ByCoverage.Bin(float64(coverage)).AddCall(call, refBase, truthBase)
+	self.ByProb.Bin(prob).AddCall(call, refBase, truthBase)
+}
+
+// BenchmarkSiteCalls calls each site with CallSite and compares the calls to the truth SNVs, truth SNVs without any
+// aligned reads are counted as FNs in the lowest coverage stratum
+func BenchmarkSiteCalls(alignment *VcAlignment, threshold *ThresholdPolicy, reference string, truth map[int]string,
+	coverageEdges, probEdges []float64) *BenchmarkReport {
+	report := BenchmarkReportConstruct(coverageEdges, probEdges)
+	for site, aln := range alignment.GroupBySite() {
+		call, coverage, prob := CallSite(aln, threshold)
+		report.addCall(site, call, coverage, prob, reference, truth)
+	}
+	for site := range truth {
+		_, called := report.Sites[site]
+		if called || site < 0 || site >= len(reference) {
+			continue
+		}
+		report.Sites[site] = BenchmarkCountsConstruct()
+		report.Sites[site].FN += 1
+		report.Total.FN += 1
+		report.ByCoverage.Bin(0).FN += 1
+	}
+	return report
+}
+
+// BenchmarkSingleMoleculeCalls compares each read's calls from CallSingleMoleculeCanonicalVariants to the truth
+// SNVs, the coverage strata use the number of reads at the site
+func BenchmarkSingleMoleculeCalls(alignment *VcAlignment, threshold *ThresholdPolicy, reference string,
+	truth map[int]string, coverageEdges, probEdges []float64) *BenchmarkReport {
+	report := BenchmarkReportConstruct(coverageEdges, probEdges)
+	siteCoverage := make(map[int]int)
+	for site, aln := range alignment.GroupBySite() {
+		siteCoverage[site] = coverage(aln)
+	}
+	for _, readCalls := range CallSingleMoleculeCanonicalVariants(alignment, threshold) {
+		for _, vc := range readCalls {
+			report.addCall(vc.RefPos, vc.Call, siteCoverage[vc.RefPos], vc.Prob, reference, truth)
+		}
+	}
+	return report
+}
@@ -0,0 +1,52 @@
+package VClr
+
+import (
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVcf(t *testing.T) {
+	vcf := "##fileformat=VCFv4.2\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tstrainA\tstrainB\n" +
+		"ref\t2\t.\tC\tT\t.\tPASS\t.\tGT:DP\t0:10\t1:12\n" +
+		"ref\t5\t.\tGA\tG\t.\tPASS\t.\tGT\t0\t1\n"
+	samples, records := ParseVcf(strings.NewReader(vcf))
+	assert.Equal(t, []string{"strainA", "strainB"}, samples)
+	assert.True(t, len(records) == 2)
+	assert.True(t, records[0].Pos == 1)
+	assert.Equal(t, []string{"0", "1"}, records[0].Genotypes)
+	truth := TruthSnvs(records)
+	assert.True(t, len(truth) == 1 && truth[1] == "T")
+}
+
+func TestBenchmarkCounts_AddCall(t *testing.T) {
+	counts := BenchmarkCountsConstruct()
+	counts.AddCall("T", "C", "T")  // TP
+	counts.AddCall("G", "C", "T")  // FP and FN
+	counts.AddCall("C", "C", "T")  // FN
+	counts.AddCall("", "C", "T")   // FN
+	counts.AddCall("A", "C", "C")  // FP
+	counts.AddCall("C", "C", "C")  // TN
+	counts.AddCall("", "C", "C")   // nothing
+	assert.True(t, counts.TP == 1 && counts.FP == 2 && counts.FN == 3 && counts.TN == 1)
+	assert.InDelta(t, 1.0/3.0, counts.Precision(), 1e-9)
+	assert.InDelta(t, 0.25, counts.Recall(), 1e-9)
+}
+
+func TestBenchmarkSiteCalls(t *testing.T) {
+	reference := "ACGTACGT"
+	truth := map[int]string{1: "T", 5: "A"}
+	vca := alignmentFromString(
+		"ref\t1\tT\t0.9\tt\tforward\tr1\n" +
+		"ref\t1\tT\t0.8\tt\tforward\tr2\n" +
+		"ref\t2\tG\t0.9\tt\tforward\tr1\n" +
+		"ref\t3\tA\t0.9\tt\tforward\tr1\n")
+	report := BenchmarkSiteCalls(vca, ThresholdPolicyConstruct(0.0), reference, truth, []float64{2}, []float64{0.5})
+	assert.True(t, report.Total.TP == 1 && report.Total.FP == 1 && report.Total.FN == 1 && report.Total.TN == 1)
+	// site 5 is uncovered so it's a FN at coverage 0
+	assert.True(t, report.Sites[5].FN == 1)
+	assert.True(t, report.ByCoverage.Counts[0].FN == 1 && report.ByCoverage.Counts[0].FP == 1)
+	assert.True(t, report.ByCoverage.Counts[1].TP == 1)
+	assert.Equal(t, "[-inf,2)", report.ByCoverage.Label(0))
+}
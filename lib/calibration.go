@@ -0,0 +1,340 @@
+package VClr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	IsotonicCalibration = "isotonic"
+	PlattCalibration    = "platt"
+	// calibrationEpsilon keeps probabilities away from 0 and 1 before taking the logit
+	calibrationEpsilon = 1e-6
+)
+
+// CalibrationMap turns a reported probability into a calibrated one. Isotonic maps interpolate linearly between the
+// points (Xs, Ys), Platt maps are 1 / (1 + exp(-(A * logit(p) + B)))
+type CalibrationMap struct {
+	Method string
+	Xs     []float64
+	Ys     []float64
+	A      float64
+	B      float64
+}
+
+func logit(p float64) float64 {
+	p = math.Min(math.Max(p, calibrationEpsilon), 1-calibrationEpsilon)
+	return math.Log(p / (1 - p))
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func (self *CalibrationMap) Apply(prob float64) float64 {
+	if self.Method == PlattCalibration {
+		return sigmoid(self.A*logit(prob) + self.B)
+	}
+	n := len(self.Xs)
+	if prob <= self.Xs[0] {
+		return self.Ys[0]
+	}
+	if prob >= self.Xs[n-1] {
+		return self.Ys[n-1]
+	}
+	i := sort.SearchFloat64s(self.Xs, prob)
+	frac := (prob - self.Xs[i-1]) / (self.Xs[i] - self.Xs[i-1])
+	return self.Ys[i-1]*(1-frac) + self.Ys[i]*frac
+}
+
+// calibrationPoint is an aligned pair's probability and whether the base was right
+type calibrationPoint struct {
+	prob    float64
+	correct bool
+}
+
+// fitIsotonic is the pool adjacent violators fit of the fraction correct as a non-decreasing function of the
+// probability, aligned pairs with the same probability start in the same block
+func fitIsotonic(points []calibrationPoint) *CalibrationMap {
+	sort.Slice(points, func(i, j int) bool { return points[i].prob < points[j].prob })
+	type block struct {
+		sumX, sumY, n float64
+	}
+	blocks := make([]block, 0)
+	for i, p := range points {
+		y := 0.0
+		if p.correct {
+			y = 1.0
+		}
+		if i > 0 && p.prob == points[i-1].prob {
+			last := &blocks[len(blocks)-1]
+			last.sumX += p.prob
+			last.sumY += y
+			last.n += 1
+		} else {
+			blocks = append(blocks, block{sumX: p.prob, sumY: y, n: 1})
+		}
+		for len(blocks) > 1 {
+			a := blocks[len(blocks)-2]
+			b := blocks[len(blocks)-1]
+			if a.sumY/a.n <= b.sumY/b.n {
+				break
+			}
+			blocks = blocks[:len(blocks)-1]
+			blocks[len(blocks)-1] = block{sumX: a.sumX + b.sumX, sumY: a.sumY + b.sumY, n: a.n + b.n}
+		}
+	}
+	cal := &CalibrationMap{Method: IsotonicCalibration, Xs: make([]float64, len(blocks)),
+		Ys: make([]float64, len(blocks))}
+	for i, b := range blocks {
+		cal.Xs[i] = b.sumX / b.n
+		cal.Ys[i] = b.sumY / b.n
+	}
+	return cal
+}
+
+// fitPlatt fits the logistic regression of correct on logit(prob) by Newton's method, using Platt's smoothed
+// targets so perfectly separated data doesn't send the parameters off to infinity
+func fitPlatt(points []calibrationPoint) *CalibrationMap {
+	nPositive := 0.0
+	for _, p := range points {
+		if p.correct {
+			nPositive += 1
+		}
+	}
+	nNegative := float64(len(points)) - nPositive
+	hiTarget := (nPositive + 1) / (nPositive + 2)
+	loTarget := 1 / (nNegative + 2)
+	a, b := 1.0, 0.0
+	for iteration := 0; iteration < 100; iteration++ {
+		// gradient and Hessian of the negative log-likelihood
+		var ga, gb, haa, hab, hbb float64
+		for _, p := range points {
+			f := logit(p.prob)
+			target := loTarget
+			if p.correct {
+				target = hiTarget
+			}
+			q := sigmoid(a*f + b)
+			ga += (q - target) * f
+			gb += q - target
+			w := q * (1 - q)
+			haa += w * f * f
+			hab += w * f
+			hbb += w
+		}
+		haa += 1e-9
+		hbb += 1e-9
+		det := haa*hbb - hab*hab
+		if det == 0 {
+			break
+		}
+		da := (hbb*ga - hab*gb) / det
+		db := (haa*gb - hab*ga) / det
+		a -= da
+		b -= db
+		if math.Abs(da) < 1e-10 && math.Abs(db) < 1e-10 {
+			break
+		}
+	}
+	return &CalibrationMap{Method: PlattCalibration, A: a, B: b}
+}
+
+// CalibrationSummary is the number of aligned pairs used to fit a map, the fraction that were correct and the mean
+// squared error (Brier score) of the probabilities before and after calibration
+type CalibrationSummary struct {
+	Strand      string
+	Base        string
+	N           int
+	FracCorrect float64
+	MeanProb    float64
+	BrierBefore float64
+	BrierAfter  float64
+}
+
+// Calibration has a map for each strand and base symbol, aligned pairs without a map are left alone
+type Calibration struct {
+	Maps    map[string]*CalibrationMap
+	Summary []*CalibrationSummary
+}
+
+func CalibrationConstruct() *Calibration {
+	return &Calibration{Maps: make(map[string]*CalibrationMap), Summary: make([]*CalibrationSummary, 0)}
+}
+
+func (self *Calibration) Apply(strand, base string, prob float64) float64 {
+	cal, check := self.Maps[thresholdKey(strand, base)]
+	if !check {
+		return prob
+	}
+	return cal.Apply(prob)
+}
+
+// Recalibrate replaces the probability of every aligned pair with its calibrated probability
+func (self *VcAlignment) Recalibrate(calibration *Calibration) {
+	for _, r := range self.Records {
+		r.prob = calibration.Apply(r.strand, r.base, r.prob)
+	}
+}
+
+// trainCalibration fits a map for each strand and base with at least minPoints aligned pairs, truth says whether
+// an aligned pair is correct and whether it should be used at all
+func trainCalibration(alignment *VcAlignment, truth func(r *AlnRecord) (bool, bool), method string,
+	minPoints int) *Calibration {
+	if method != IsotonicCalibration && method != PlattCalibration {
+		err := fmt.Sprintf("trainCalibration: method must be %v or %v, got %v", IsotonicCalibration,
+			PlattCalibration, method)
+		panic(err)
+	}
+	points := make(map[string][]calibrationPoint)
+	for _, r := range alignment.Records {
+		correct, use := truth(r)
+		if !use {
+			continue
+		}
+		key := thresholdKey(r.strand, r.base)
+		points[key] = append(points[key], calibrationPoint{prob: r.prob, correct: correct})
+	}
+	keys := make([]string, 0, len(points))
+	for key := range points {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	calibration := CalibrationConstruct()
+	for _, key := range keys {
+		keyPoints := points[key]
+		if len(keyPoints) < minPoints || len(keyPoints) == 0 {
+			continue
+		}
+		var cal *CalibrationMap
+		if method == IsotonicCalibration {
+			cal = fitIsotonic(keyPoints)
+		} else {
+			cal = fitPlatt(keyPoints)
+		}
+		calibration.Maps[key] = cal
+		parts := strings.Split(key, "\t")
+		summary := &CalibrationSummary{Strand: parts[0], Base: parts[1], N: len(keyPoints)}
+		for _, p := range keyPoints {
+			y := 0.0
+			if p.correct {
+				y = 1.0
+			}
+			after := cal.Apply(p.prob)
+			summary.FracCorrect += y
+			summary.MeanProb += p.prob
+			summary.BrierBefore += (p.prob - y) * (p.prob - y)
+			summary.BrierAfter += (after - y) * (after - y)
+		}
+		n := float64(len(keyPoints))
+		summary.FracCorrect /= n
+		summary.MeanProb /= n
+		summary.BrierBefore /= n
+		summary.BrierAfter /= n
+		calibration.Summary = append(calibration.Summary, summary)
+	}
+	return calibration
+}
+
+// TrainCalibrationFromReference fits the probability of canonical bases (corrected for strand) matching the
+// reference, modified base symbols and sites outside the reference are skipped
+func TrainCalibrationFromReference(alignment *VcAlignment, reference, method string, minPoints int) *Calibration {
+	return trainCalibration(alignment, func(r *AlnRecord) (bool, bool) {
+		if !isCanonicalBase(r.base) || r.refPos < 0 || r.refPos >= len(reference) {
+			return false, false
+		}
+		refBase := strings.ToUpper(string(reference[r.refPos]))
+		return correctBaseForStrand(r.base, r.strand, r.forward) == refBase, true
+	}, method, minPoints)
+}
+
+// TrainCalibrationFromControl fits the probabilities from a control where every site is modified (or unmodified),
+// so modified base symbols are correct (or incorrect) and the canonical ones are the opposite
+func TrainCalibrationFromControl(alignment *VcAlignment, modified bool, method string,
+	minPoints int) *Calibration {
+	return trainCalibration(alignment, func(r *AlnRecord) (bool, bool) {
+		return isMethylBase(r.base) == modified, true
+	}, method, minPoints)
+}
+
+// WriteCalibration writes one tab-separated line per map: strand, base, method and then either A and B or the
+// comma separated Xs and Ys
+func WriteCalibration(w io.Writer, calibration *Calibration) {
+	keys := make([]string, 0, len(calibration.Maps))
+	for key := range calibration.Maps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "#strand\tbase\tmethod\tparameters\n")
+	for _, key := range keys {
+		cal := calibration.Maps[key]
+		if cal.Method == PlattCalibration {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", key, cal.Method, strconv.FormatFloat(cal.A, 'g', -1, 64),
+				strconv.FormatFloat(cal.B, 'g', -1, 64))
+			continue
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", key, cal.Method, formatFloatList(cal.Xs), formatFloatList(cal.Ys))
+	}
+}
+
+func formatFloatList(values []float64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(s, ",")
+}
+
+func parseFloatField(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic(fmt.Sprintf("ParseCalibration: bad number %v", s))
+	}
+	return v
+}
+
+// ParseCalibration reads a model written by WriteCalibration
+func ParseCalibration(file io.Reader) *Calibration {
+	calibration := CalibrationConstruct()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			err := fmt.Sprintf("ParseCalibration: malformed line %v", line)
+			panic(err)
+		}
+		cal := &CalibrationMap{Method: fields[2]}
+		switch cal.Method {
+		case PlattCalibration:
+			cal.A = parseFloatField(fields[3])
+			cal.B = parseFloatField(fields[4])
+		case IsotonicCalibration:
+			for _, x := range strings.Split(fields[3], ",") {
+				cal.Xs = append(cal.Xs, parseFloatField(x))
+			}
+			for _, y := range strings.Split(fields[4], ",") {
+				cal.Ys = append(cal.Ys, parseFloatField(y))
+			}
+			if len(cal.Xs) != len(cal.Ys) || len(cal.Xs) == 0 {
+				panic(fmt.Sprintf("ParseCalibration: mismatched points in line %v", line))
+			}
+		default:
+			panic(fmt.Sprintf("ParseCalibration: unknown method %v", cal.Method))
+		}
+		calibration.Maps[thresholdKey(fields[0], fields[1])] = cal
+	}
+	if err := scanner.Err(); err != nil {
+		panic(fmt.Sprintf("ParseCalibration: %v", err))
+	}
+	return calibration
+}
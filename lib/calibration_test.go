@@ -0,0 +1,72 @@
+package VClr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitIsotonic(t *testing.T) {
+	points := []calibrationPoint{{0.9, true}, {0.3, false}, {0.1, false}, {0.9, true}, {0.2, true}}
+	cal := fitIsotonic(points)
+	// 0.2 and 0.3 are pooled
+	assert.Equal(t, []float64{0.1, 0.25, 0.9}, cal.Xs)
+	assert.Equal(t, []float64{0.0, 0.5, 1.0}, cal.Ys)
+	assert.InDelta(t, 0.5+0.5*0.25/0.65, cal.Apply(0.5), 1e-9)
+	assert.InDelta(t, 0.0, cal.Apply(0.05), 1e-12)
+	assert.InDelta(t, 1.0, cal.Apply(0.95), 1e-12)
+}
+
+func TestFitPlatt(t *testing.T) {
+	points := make([]calibrationPoint, 0)
+	for i := 0; i < 1000; i++ {
+		points = append(points, calibrationPoint{0.9, i%10 < 6})
+		points = append(points, calibrationPoint{0.6, i%10 < 4})
+	}
+	cal := fitPlatt(points)
+	// over-confident probabilities get pulled in
+	assert.InDelta(t, 0.6, cal.Apply(0.9), 0.01)
+	assert.InDelta(t, 0.4, cal.Apply(0.6), 0.01)
+}
+
+func TestTrainCalibration(t *testing.T) {
+	reference := "AAAAAAAAAACAAAAAAAAA"
+	table := ""
+	for _, r := range []string{"r1", "r2", "r3", "r4"} {
+		table += "ref\t10\tC\t0.6\tt\tforward\t" + r + "\n" +
+			"ref\t10\tT\t0.4\tt\tforward\t" + r + "\n" +
+			"ref\t10\tI\t0.5\tt\tforward\t" + r + "\n"
+	}
+	// complement reads in the forward orientation are reverse complemented, G is correct
+	table += "ref\t10\tG\t0.7\tc\tforward\tr5\n"
+	vca := alignmentFromString(table)
+	calibration := TrainCalibrationFromReference(vca, reference, IsotonicCalibration, 1)
+	assert.True(t, len(calibration.Maps) == 3)
+	assert.True(t, len(calibration.Summary) == 3 && calibration.Summary[0].Strand == "c")
+	assert.InDelta(t, 1.0, calibration.Apply("t", "C", 0.6), 1e-12)
+	assert.InDelta(t, 0.0, calibration.Apply("t", "T", 0.4), 1e-12)
+	// no map for modified bases, they are left alone
+	assert.InDelta(t, 0.5, calibration.Apply("t", "I", 0.5), 1e-12)
+	assert.True(t, calibration.Summary[1].BrierAfter < calibration.Summary[1].BrierBefore)
+	assert.True(t, len(TrainCalibrationFromReference(vca, reference, IsotonicCalibration, 2).Maps) == 2)
+
+	control := TrainCalibrationFromControl(vca, true, PlattCalibration, 1)
+	assert.True(t, len(control.Maps) == 4)
+	assert.True(t, control.Apply("t", "I", 0.5) > 0.5 && control.Apply("t", "C", 0.6) < 0.6)
+
+	var out bytes.Buffer
+	WriteCalibration(&out, calibration)
+	parsed := ParseCalibration(strings.NewReader(out.String()))
+	assert.Equal(t, calibration.Maps, parsed.Maps)
+	out.Reset()
+	WriteCalibration(&out, control)
+	parsed = ParseCalibration(strings.NewReader(out.String()))
+	assert.InDelta(t, control.Apply("t", "I", 0.5), parsed.Apply("t", "I", 0.5), 1e-12)
+
+	vca.Recalibrate(calibration)
+	call, prob := vca.GroupByStrand()["t"].CallSiteOnCodingStrand(ThresholdPolicyConstruct(0.0))
+	// the calibrated C probabilities go up to 1 and the T ones down to 0
+	assert.True(t, call == "C")
+	assert.InDelta(t, 4.0/6.0, prob, 1e-9)
+}
@@ -0,0 +1,206 @@
+package VClr
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// ReadSiteMatrix holds each read's calls over a set of sites, missing calls are the empty string. In methylation
+// mode the calls are "M" (methylated) or "U" (unmethylated), otherwise they are the called bases
+type ReadSiteMatrix struct {
+	Reads  []string
+	Sites  []int
+	Values [][]string
+}
+
+// ReadSiteMatrixConstruct builds the matrix from single molecule calls (CallSingleMoleculeMethylation,
+// CallSingleMoleculeGatcMethylation or CallSingleMoleculeCanonicalVariants) over the sites in [start, end], a
+// negative end means no upper limit. Reads with fewer than minCalls calls in the region are left out
+func ReadSiteMatrixConstruct(readCalls [][]*VariantCall, start, end int, methyl bool, minCalls int) *ReadSiteMatrix {
+	inRegion := func(site int) bool { return site >= start && (end < 0 || site <= end) }
+	value := func(call string) string {
+		if !methyl {
+			return call
+		}
+		methylated, informative := methylState(call)
+		switch {
+		case !informative:
+			return ""
+		case methylated:
+			return "M"
+		default:
+			return "U"
+		}
+	}
+	siteSet := make(map[int]bool)
+	readValues := make(map[string]map[int]string)
+	for _, calls := range readCalls {
+		for _, vc := range calls {
+			v := value(vc.Call)
+			if v == "" || !inRegion(vc.RefPos) {
+				continue
+			}
+			_, check := readValues[vc.ReadLabel]
+			if !check {
+				readValues[vc.ReadLabel] = make(map[int]string)
+			}
+			readValues[vc.ReadLabel][vc.RefPos] = v
+		}
+	}
+	reads := make([]string, 0, len(readValues))
+	for read, values := range readValues {
+		if len(values) < minCalls {
+			continue
+		}
+		reads = append(reads, read)
+		for site := range values {
+			siteSet[site] = true
+		}
+	}
+	sort.Strings(reads)
+	sites := make([]int, 0, len(siteSet))
+	for site := range siteSet {
+		sites = append(sites, site)
+	}
+	sort.Ints(sites)
+	values := make([][]string, len(reads))
+	for i, read := range reads {
+		values[i] = make([]string, len(sites))
+		for j, site := range sites {
+			values[i][j] = readValues[read][site]
+		}
+	}
+	return &ReadSiteMatrix{Reads: reads, Sites: sites, Values: values}
+}
+
+// MissingTolerantDistance is the fraction of mismatches over the sites called in both rows, 1 if there are none
+func MissingTolerantDistance(a, b []string) float64 {
+	shared := 0
+	mismatches := 0
+	for i := range a {
+		if a[i] == "" || b[i] == "" {
+			continue
+		}
+		shared += 1
+		if a[i] != b[i] {
+			mismatches += 1
+		}
+	}
+	if shared == 0 {
+		return 1.0
+	}
+	return float64(mismatches) / float64(shared)
+}
+
+// columnModes is the most common value at each site for the rows in members, ties go to the smallest value and
+// sites without any calls are missing
+func columnModes(values [][]string, members []int, nSites int) ([]string, []float64) {
+	modes := make([]string, nSites)
+	support := make([]float64, nSites)
+	for j := 0; j < nSites; j++ {
+		counts := make(map[string]int)
+		total := 0
+		for _, i := range members {
+			if values[i][j] != "" {
+				counts[values[i][j]] += 1
+				total += 1
+			}
+		}
+		best := ""
+		for v, n := range counts {
+			if best == "" || n > counts[best] || (n == counts[best] && v < best) {
+				best = v
+			}
+		}
+		modes[j] = best
+		if total > 0 {
+			support[j] = float64(counts[best]) / float64(total)
+		}
+	}
+	return modes, support
+}
+
+// ReadClusters is the result of clustering a ReadSiteMatrix, Consensus[c] is the mode of cluster c at each site and
+// Support is the fraction of the cluster's reads called at the site that agree with it
+type ReadClusters struct {
+	Assignments []int
+	Distances   []float64
+	Consensus   [][]string
+	Support     [][]float64
+}
+
+// KModes clusters the reads into k clusters using MissingTolerantDistance. The initial modes are a random read
+// followed by the reads farthest from the modes chosen so far
+func KModes(matrix *ReadSiteMatrix, k, maxIterations int, rng *rand.Rand) *ReadClusters {
+	nReads := len(matrix.Reads)
+	nSites := len(matrix.Sites)
+	if k > nReads {
+		k = nReads
+	}
+	assignments := make([]int, nReads)
+	distances := make([]float64, nReads)
+	if k < 1 {
+		return &ReadClusters{Assignments: assignments, Distances: distances, Consensus: make([][]string, 0),
+			Support: make([][]float64, 0)}
+	}
+	modes := make([][]string, 0, k)
+	modes = append(modes, matrix.Values[rng.Intn(nReads)])
+	for len(modes) < k {
+		farthest := 0
+		farthestDistance := -1.0
+		for i, row := range matrix.Values {
+			closest := 2.0
+			for _, mode := range modes {
+				d := MissingTolerantDistance(row, mode)
+				if d < closest {
+					closest = d
+				}
+			}
+			if closest > farthestDistance {
+				farthestDistance = closest
+				farthest = i
+			}
+		}
+		modes = append(modes, matrix.Values[farthest])
+	}
+	for i := range assignments {
+		assignments[i] = -1
+	}
+	support := make([][]float64, k)
+	for c := range support {
+		support[c] = make([]float64, nSites)
+	}
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		changed := false
+		for i, row := range matrix.Values {
+			best := 0
+			bestDistance := 2.0
+			for c, mode := range modes {
+				d := MissingTolerantDistance(row, mode)
+				if d < bestDistance {
+					bestDistance = d
+					best = c
+				}
+			}
+			if assignments[i] != best {
+				changed = true
+			}
+			assignments[i] = best
+			distances[i] = bestDistance
+		}
+		members := make([][]int, k)
+		for i, c := range assignments {
+			members[c] = append(members[c], i)
+		}
+		for c := 0; c < k; c++ {
+			if len(members[c]) == 0 {
+				continue
+			}
+			modes[c], support[c] = columnModes(matrix.Values, members[c], nSites)
+		}
+		if !changed {
+			break
+		}
+	}
+	return &ReadClusters{Assignments: assignments, Distances: distances, Consensus: modes, Support: support}
+}
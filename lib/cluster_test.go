@@ -0,0 +1,43 @@
+package VClr
+
+import (
+	"math/rand"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingTolerantDistance(t *testing.T) {
+	assert.InDelta(t, 0.5, MissingTolerantDistance([]string{"M", "U", "", "M"}, []string{"M", "M", "U", ""}), 1e-9)
+	assert.InDelta(t, 1.0, MissingTolerantDistance([]string{"M", ""}, []string{"", "U"}), 1e-9)
+}
+
+func TestKModes(t *testing.T) {
+	// two populations, methylated at 1 and 2 or at 3 and 4, with some missing calls
+	table := ""
+	for _, read := range []string{"a1", "a2", "a3"} {
+		table += "ref\t1\tI\t0.9\tt\tforward\t" + read + "\n" +
+			"ref\t2\tI\t0.9\tt\tforward\t" + read + "\n" +
+			"ref\t3\tA\t0.9\tt\tforward\t" + read + "\n"
+	}
+	for _, read := range []string{"b1", "b2"} {
+		table += "ref\t2\tA\t0.9\tt\tforward\t" + read + "\n" +
+			"ref\t3\tI\t0.9\tt\tforward\t" + read + "\n" +
+			"ref\t4\tI\t0.9\tt\tforward\t" + read + "\n"
+	}
+	table += "ref\t9\tI\t0.9\tt\tforward\tb3\n"
+	vca := alignmentFromString(table)
+	matrix := ReadSiteMatrixConstruct(CallSingleMoleculeMethylation(vca, ThresholdPolicyConstruct(0.0)), 0, 5, true, 2)
+	// b3 is out of the region
+	assert.Equal(t, []string{"a1", "a2", "a3", "b1", "b2"}, matrix.Reads)
+	assert.Equal(t, []int{1, 2, 3, 4}, matrix.Sites)
+	assert.Equal(t, []string{"", "U", "M", "M"}, matrix.Values[3])
+
+	clusters := KModes(matrix, 2, 10, rand.New(rand.NewSource(1)))
+	a := clusters.Assignments[0]
+	b := clusters.Assignments[3]
+	assert.True(t, a != b)
+	assert.Equal(t, []int{a, a, a, b, b}, clusters.Assignments)
+	assert.Equal(t, []string{"M", "M", "U", ""}, clusters.Consensus[a])
+	assert.Equal(t, []string{"", "U", "M", "M"}, clusters.Consensus[b])
+	assert.InDelta(t, 1.0, clusters.Support[b][1], 1e-9)
+}
@@ -0,0 +1,60 @@
+package VClr
+
+import (
+	"sort"
+	"strings"
+)
+
+// Substitution is a reference position changed by PolishReference
+type Substitution struct {
+	RefPos   int
+	RefBase  string
+	Call     string
+	Coverage int
+	Prob     float64
+}
+
+func isCanonicalBase(base string) bool {
+	return base == "A" || base == "C" || base == "G" || base == "T"
+}
+
+// PolishReference applies the CallSite calls to the reference. Positions with fewer than minCoverage reads (this
+// includes positions without any aligned reads when minCoverage > 0), with a call probability below minProb, without
+// a call or with a non-canonical call are low confidence and are masked with N, or with the lower case reference base
+// if maskLowercase is set. Returns the consensus and the substitutions sorted by position
+func PolishReference(reference string, alignment *VcAlignment, threshold *ThresholdPolicy, minCoverage int,
+	minProb float64, maskLowercase bool) (string, []*Substitution) {
+	consensus := []byte(strings.ToUpper(reference))
+	covered := make([]bool, len(consensus))
+	confident := make([]bool, len(consensus))
+	substitutions := make([]*Substitution, 0)
+	for site, aln := range alignment.GroupBySite() {
+		if site < 0 || site >= len(consensus) {
+			continue
+		}
+		covered[site] = true
+		call, coverage, prob := CallSite(aln, threshold)
+		if coverage < minCoverage || prob < minProb || !isCanonicalBase(call) {
+			continue
+		}
+		confident[site] = true
+		refBase := string(consensus[site])
+		if call != refBase {
+			consensus[site] = call[0]
+			substitutions = append(substitutions, &Substitution{RefPos: site, RefBase: refBase, Call: call,
+				Coverage: coverage, Prob: prob})
+		}
+	}
+	for i := range consensus {
+		if confident[i] || (!covered[i] && minCoverage <= 0) {
+			continue
+		}
+		if maskLowercase {
+			consensus[i] = strings.ToLower(string(consensus[i]))[0]
+		} else {
+			consensus[i] = 'N'
+		}
+	}
+	sort.Slice(substitutions, func(i, j int) bool { return substitutions[i].RefPos < substitutions[j].RefPos })
+	return string(consensus), substitutions
+}
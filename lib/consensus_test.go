@@ -0,0 +1,27 @@
+package VClr
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolishReference(t *testing.T) {
+	reference := "ACGTACGT"
+	vca := alignmentFromString(
+		"ref\t0\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t0\tA\t0.9\tt\tforward\tr2\n" +
+		"ref\t1\tT\t0.9\tt\tforward\tr1\n" +
+		"ref\t1\tT\t0.8\tt\tforward\tr2\n" +
+		"ref\t2\tA\t0.9\tt\tforward\tr1\n")  // only one read
+	consensus, substitutions := PolishReference(reference, vca, ThresholdPolicyConstruct(0.0), 2, 0.0, false)
+	assert.Equal(t, "ATNNNNNN", consensus)
+	assert.True(t, len(substitutions) == 1)
+	assert.True(t, substitutions[0].RefPos == 1 && substitutions[0].RefBase == "C" && substitutions[0].Call == "T")
+
+	consensus, _ = PolishReference(reference, vca, ThresholdPolicyConstruct(0.0), 2, 0.0, true)
+	assert.Equal(t, "ATgtacgt", consensus)
+
+	// with no minimum coverage uncovered positions keep the reference base
+	consensus, _ = PolishReference(reference, vca, ThresholdPolicyConstruct(0.0), 0, 0.0, false)
+	assert.Equal(t, "ATATACGT", consensus)
+}
@@ -0,0 +1,107 @@
+package VClr
+
+import (
+	"fmt"
+	"strings"
+)
+
+var complementBases = map[byte]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A', 'N': 'N'}
+
+// reverseComplement works on upper case DNA, anything that isn't ACGT becomes an N
+func reverseComplement(seq string) string {
+	rc := make([]byte, len(seq))
+	for i := 0; i < len(seq); i++ {
+		c, ok := complementBases[seq[len(seq)-1-i]]
+		if !ok {
+			c = 'N'
+		}
+		rc[i] = c
+	}
+	return string(rc)
+}
+
+// onCodingStrand is true when the read's bases are in the same orientation as the reference, see
+// correctBaseForStrand
+func onCodingStrand(strand string, forward bool) bool {
+	isTemplate := strand == "t"
+	return (isTemplate && forward) || (!isTemplate && !forward)
+}
+
+// KmerContext returns the k-mer of the reference centered on site, reverse complemented when the read went through
+// the pore on the opposite strand. Returns the empty string when the k-mer runs off the end of the reference
+func KmerContext(reference string, site, k int, strand string, forward bool) string {
+	if k < 1 {
+		panic(fmt.Sprintf("KmerContext: k must be positive, got %v", k))
+	}
+	start := site - (k-1)/2
+	end := start + k
+	if start < 0 || end > len(reference) {
+		return ""
+	}
+	kmer := strings.ToUpper(reference[start:end])
+	if onCodingStrand(strand, forward) {
+		return kmer
+	}
+	return reverseComplement(kmer)
+}
+
+// forEachOrientedRead splits the alignment into single reads, then by strand and by orientation, and calls fn on
+// each piece
+func forEachOrientedRead(alignment *VcAlignment, fn func(strand string, forward bool, aln *VcAlignment)) {
+	for _, readAln := range alignment.GroupByRead() {
+		for strand, strandAln := range readAln.GroupByStrand() {
+			for forward, aln := range strandAln.GroupByForward() {
+				fn(strand, forward, aln)
+			}
+		}
+	}
+}
+
+// SingleMoleculeVariantContexts stratifies the accuracy of single molecule canonical calls by the k-mer context of
+// each site, sites without a call or without a full k-mer are skipped
+func SingleMoleculeVariantContexts(alignment *VcAlignment, threshold *ThresholdPolicy, reference string,
+	k int) map[string]*AccuracyStats {
+	contexts := make(map[string]*AccuracyStats)
+	forEachOrientedRead(alignment, func(strand string, forward bool, aln *VcAlignment) {
+		for _, readCalls := range CallSingleMoleculeCanonicalVariants(aln, threshold) {
+			for _, vc := range readCalls {
+				kmer := KmerContext(reference, vc.RefPos, k, strand, forward)
+				if vc.Call == "" || kmer == "" {
+					continue
+				}
+				_, check := contexts[kmer]
+				if !check {
+					contexts[kmer] = AccuracyStatsConstruct()
+				}
+				contexts[kmer].AddCall(vc.Call, strings.ToUpper(string(reference[vc.RefPos])))
+			}
+		}
+	})
+	return contexts
+}
+
+// SingleMoleculeMethylationContexts stratifies the single molecule methylation calls by the k-mer context of each
+// site, sites without a full k-mer are skipped
+func SingleMoleculeMethylationContexts(alignment *VcAlignment, threshold *ThresholdPolicy, reference string,
+	k int) map[string]*SiteCallStats {
+	contexts := make(map[string]*SiteCallStats)
+	forEachOrientedRead(alignment, func(strand string, forward bool, aln *VcAlignment) {
+		for _, readCalls := range CallSingleMoleculeMethylation(aln, threshold) {
+			for _, vc := range readCalls {
+				if vc.Call == "" {
+					continue
+				}
+				kmer := KmerContext(reference, vc.RefPos, k, strand, forward)
+				if kmer == "" {
+					continue
+				}
+				_, check := contexts[kmer]
+				if !check {
+					contexts[kmer] = SiteCallStatsConstruct()
+				}
+				contexts[kmer].AddCall(vc.Call)
+			}
+		}
+	})
+	return contexts
+}
@@ -0,0 +1,31 @@
+package VClr
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKmerContext(t *testing.T) {
+	reference := "aacGATCtt"
+	assert.Equal(t, "CGATC", KmerContext(reference, 4, 5, "t", true))
+	assert.Equal(t, "CGATC", KmerContext(reference, 4, 5, "c", false))
+	assert.Equal(t, "GATCG", KmerContext(reference, 4, 5, "t", false))
+	assert.Equal(t, "GATCG", KmerContext(reference, 4, 5, "c", true))
+	assert.Equal(t, "", KmerContext(reference, 1, 5, "t", true))
+	assert.Equal(t, "T", KmerContext(reference, 7, 1, "t", true))
+}
+
+func TestSingleMoleculeMethylationContexts(t *testing.T) {
+	reference := "GATCGATC"
+	vca := alignmentFromString(
+		"ref\t1\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t5\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t5\tI\t0.9\tt\tforward\tr2\n" +
+		"ref\t5\tA\t0.3\tt\tforward\tr3\n")
+	contexts := SingleMoleculeMethylationContexts(vca, ThresholdPolicyConstruct(0.5), reference, 3)
+	assert.True(t, len(contexts) == 1)
+	// r3 is below the threshold so it isn't a call
+	assert.True(t, contexts["GAT"].NumberOfCalls() == 3)
+	assert.True(t, contexts["GAT"].NumberOfMethylatedCalls() == 2)
+	assert.InDelta(t, 200.0/3.0, contexts["GAT"].PercentMethylatedCalls(), 1e-9)
+}
@@ -0,0 +1,76 @@
+package VClr
+
+import (
+	"sort"
+)
+
+// DifferentialSite holds the methylation calls for a site (or a window of sites) in two conditions
+type DifferentialSite struct {
+	Start   int
+	End     int
+	NSites  int
+	Case    *SiteCallStats
+	Control *SiteCallStats
+	PValue  float64
+	QValue  float64
+}
+
+func DifferentialSiteConstruct(start, end int) *DifferentialSite {
+	return &DifferentialSite{Start: start, End: end, NSites: 0, Case: SiteCallStatsConstruct(),
+		Control: SiteCallStatsConstruct()}
+}
+
+// DeltaPercentMethylated is case minus control
+func (self *DifferentialSite) DeltaPercentMethylated() float64 {
+	return self.Case.PercentMethylatedCalls() - self.Control.PercentMethylatedCalls()
+}
+
+// fisherTest tests methylated vs canonical calls in case vs control
+func (self *DifferentialSite) fisherTest() float64 {
+	caseMethyl := self.Case.NumberOfMethylatedCalls()
+	controlMethyl := self.Control.NumberOfMethylatedCalls()
+	return FisherExactTest(caseMethyl, self.Case.NumberOfCalls()-caseMethyl,
+		controlMethyl, self.Control.NumberOfCalls()-controlMethyl)
+}
+
+// DifferentialMethylation compares the single molecule site calls of two conditions. Only sites with calls in both
+// conditions are reported. If window is greater than 0 the sites are aggregated into non-overlapping windows of that
+// many reference positions and each window is tested as a whole. The results are sorted by position and have
+// Benjamini-Hochberg q-values
+func DifferentialMethylation(caseCalls, controlCalls map[int]*SiteCallStats, window int) []*DifferentialSite {
+	regions := make(map[int]*DifferentialSite)
+	for site, caseStats := range caseCalls {
+		controlStats, check := controlCalls[site]
+		if !check || caseStats.NumberOfCalls() == 0 || controlStats.NumberOfCalls() == 0 {
+			continue
+		}
+		start, end := site, site
+		if window > 0 {
+			start = (site / window) * window
+			end = start + window - 1
+		}
+		_, check = regions[start]
+		if !check {
+			regions[start] = DifferentialSiteConstruct(start, end)
+		}
+		regions[start].Case.Merge(caseStats)
+		regions[start].Control.Merge(controlStats)
+		regions[start].NSites += 1
+	}
+	results := make([]*DifferentialSite, 0, len(regions))
+	for _, r := range regions {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Start < results[j].Start })
+
+	pValues := make([]float64, len(results))
+	for i, r := range results {
+		r.PValue = r.fisherTest()
+		pValues[i] = r.PValue
+	}
+	qValues := BenjaminiHochberg(pValues)
+	for i, r := range results {
+		r.QValue = qValues[i]
+	}
+	return results
+}
@@ -0,0 +1,43 @@
+package VClr
+
+import (
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// alignmentFromString parses a signalAlign style variant call table
+func alignmentFromString(table string) *VcAlignment {
+	vca := VcAlignmentConstruct()
+	ParseAlignmentFile(strings.NewReader(table), vca)
+	return vca
+}
+
+func TestDifferentialMethylation(t *testing.T) {
+	caseAln := alignmentFromString(
+		"ref\t10\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t10\tI\t0.8\tt\tforward\tr2\n" +
+		"ref\t10\tI\t0.9\tt\tforward\tr3\n" +
+		"ref\t12\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t40\tI\t0.9\tt\tforward\tr1\n")
+	controlAln := alignmentFromString(
+		"ref\t10\tA\t0.9\tt\tforward\tc1\n" +
+		"ref\t10\tA\t0.9\tt\tforward\tc2\n" +
+		"ref\t12\tA\t0.9\tt\tforward\tc1\n")
+	caseCalls := SingleMoleculeSiteCalls(caseAln, ThresholdPolicyConstruct(0.0))
+	controlCalls := SingleMoleculeSiteCalls(controlAln, ThresholdPolicyConstruct(0.0))
+
+	bySite := DifferentialMethylation(caseCalls, controlCalls, 0)
+	// site 40 has no control calls
+	assert.True(t, len(bySite) == 2)
+	assert.True(t, bySite[0].Start == 10 && bySite[1].Start == 12)
+	assert.InDelta(t, 100.0, bySite[0].DeltaPercentMethylated(), 1e-9)
+	assert.InDelta(t, 0.1, bySite[0].PValue, 1e-9)
+	assert.True(t, bySite[1].PValue == 1.0)
+
+	byWindow := DifferentialMethylation(caseCalls, controlCalls, 20)
+	assert.True(t, len(byWindow) == 1)
+	assert.True(t, byWindow[0].Start == 0 && byWindow[0].End == 19 && byWindow[0].NSites == 2)
+	assert.True(t, byWindow[0].Case.NumberOfCalls() == 4)
+	assert.True(t, byWindow[0].Control.NumberOfCalls() == 3)
+}
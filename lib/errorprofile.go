@@ -0,0 +1,133 @@
+package VClr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NoCall is used in place of the empty string when a site could not be called
+const NoCall = "-"
+
+// AccuracyStats counts how many calls agree with the truth
+type AccuracyStats struct {
+	nCorrect int
+	nCalls   int
+}
+
+func AccuracyStatsConstruct() *AccuracyStats {
+	return &AccuracyStats{nCorrect: 0, nCalls: 0}
+}
+
+func (self *AccuracyStats) AddCall(call, truth string) {
+	if call == truth {
+		self.nCorrect += 1
+	}
+	self.nCalls += 1
+}
+
+func (self *AccuracyStats) PercentCorrect() float64 {
+	return (float64(self.nCorrect) / float64(self.nCalls)) * 100
+}
+
+func (self *AccuracyStats) ErrorRate() float64 {
+	return float64(self.nCalls-self.nCorrect) / float64(self.nCalls)
+}
+
+func (self *AccuracyStats) NumberOfCalls() int {
+	return self.nCalls
+}
+
+func (self *AccuracyStats) NumberOfErrors() int {
+	return self.nCalls - self.nCorrect
+}
+
+// ConfusionMatrix counts reference bases (rows) vs called bases (columns)
+type ConfusionMatrix struct {
+	counts map[string]map[string]int
+}
+
+func ConfusionMatrixConstruct() *ConfusionMatrix {
+	return &ConfusionMatrix{counts: make(map[string]map[string]int)}
+}
+
+func (self *ConfusionMatrix) Add(ref, call string) {
+	_, check := self.counts[ref]
+	if !check {
+		self.counts[ref] = make(map[string]int)
+	}
+	self.counts[ref][call] += 1
+}
+
+func (self *ConfusionMatrix) Count(ref, call string) int {
+	return self.counts[ref][call]
+}
+
+// Alphabet is the sorted set of every base seen as either a reference or a called base
+func (self *ConfusionMatrix) Alphabet() []string {
+	seen := make(map[string]bool)
+	for ref, calls := range self.counts {
+		seen[ref] = true
+		for call := range calls {
+			seen[call] = true
+		}
+	}
+	alphabet := make([]string, 0, len(seen))
+	for b := range seen {
+		alphabet = append(alphabet, b)
+	}
+	sort.Strings(alphabet)
+	return alphabet
+}
+
+// ErrorProfile has a confusion matrix for each strand and orientation, keyed like "t-forward", and the error rate at
+// each reference position
+type ErrorProfile struct {
+	Matrices  map[string]*ConfusionMatrix
+	Positions map[int]*AccuracyStats
+}
+
+func ErrorProfileConstruct() *ErrorProfile {
+	return &ErrorProfile{Matrices: make(map[string]*ConfusionMatrix), Positions: make(map[int]*AccuracyStats)}
+}
+
+func orientationLabel(strand string, forward bool) string {
+	if forward {
+		return strand + "-forward"
+	}
+	return strand + "-backward"
+}
+
+// SingleMoleculeErrorProfile calls every site on every read (per strand) with CallSingleMoleculeCanonicalVariants
+// and compares the calls to the reference. Sites that couldn't be called go in the NoCall column of the matrices but
+// don't count towards the per-position error rates
+func SingleMoleculeErrorProfile(alignment *VcAlignment, threshold *ThresholdPolicy, reference string) *ErrorProfile {
+	profile := ErrorProfileConstruct()
+	forEachOrientedRead(alignment, func(strand string, forward bool, aln *VcAlignment) {
+		label := orientationLabel(strand, forward)
+		_, check := profile.Matrices[label]
+		if !check {
+			profile.Matrices[label] = ConfusionMatrixConstruct()
+		}
+		for _, readCalls := range CallSingleMoleculeCanonicalVariants(aln, threshold) {
+			for _, vc := range readCalls {
+				if vc.RefPos < 0 || vc.RefPos >= len(reference) {
+					err := fmt.Sprintf("SingleMoleculeErrorProfile: site %v is outside of the reference", vc.RefPos)
+					panic(err)
+				}
+				refBase := strings.ToUpper(string(reference[vc.RefPos]))
+				if vc.Call == "" {
+					profile.Matrices[label].Add(refBase, NoCall)
+					continue
+				}
+				profile.Matrices[label].Add(refBase, vc.Call)
+				_, check := profile.Positions[vc.RefPos]
+				if !check {
+					profile.Positions[vc.RefPos] = AccuracyStatsConstruct()
+				}
+				profile.Positions[vc.RefPos].AddCall(vc.Call, refBase)
+			}
+		}
+	})
+	return profile
+}
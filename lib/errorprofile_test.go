@@ -0,0 +1,27 @@
+package VClr
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSingleMoleculeErrorProfile(t *testing.T) {
+	reference := "ACGT"
+	vca := alignmentFromString(
+		"ref\t0\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t1\tC\t0.9\tt\tforward\tr1\n" +
+		"ref\t1\tC\t0.9\tc\tforward\tr1\n" +  // complement forward is reverse complemented, so this is a G
+		"ref\t2\tG\t0.9\tt\tbackward\tr2\n" +  // template backward is reverse complemented too, so a C
+		"ref\t3\tT\t0.9\tt\tbackward\tr2\n")  // and this is an A
+	profile := SingleMoleculeErrorProfile(vca, ThresholdPolicyConstruct(0.0), reference)
+	assert.True(t, len(profile.Matrices) == 3)
+	assert.True(t, profile.Matrices["t-forward"].Count("A", "A") == 1)
+	assert.True(t, profile.Matrices["t-forward"].Count("C", "C") == 1)
+	assert.True(t, profile.Matrices["c-forward"].Count("C", "G") == 1)
+	assert.True(t, profile.Matrices["t-backward"].Count("G", "C") == 1)
+	assert.True(t, profile.Matrices["t-backward"].Count("T", "A") == 1)
+	assert.Equal(t, []string{"A", "C", "G", "T"}, profile.Matrices["t-backward"].Alphabet())
+	assert.True(t, profile.Positions[1].NumberOfCalls() == 2)
+	assert.InDelta(t, 0.5, profile.Positions[1].ErrorRate(), 1e-9)
+	assert.InDelta(t, 0.0, profile.Positions[0].ErrorRate(), 1e-9)
+}
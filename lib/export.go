@@ -0,0 +1,69 @@
+package VClr
+
+import (
+	"math"
+	"sort"
+)
+
+// maxPhred caps the quality so that probabilities of 1 are still printable
+const maxPhred = 60
+
+// ProbToPhred converts the probability that a call is correct into a phred scaled quality, capped at maxPhred, no
+// calls (NaN or -Inf probabilities) get 0
+func ProbToPhred(p float64) int {
+	if math.IsNaN(p) || p <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return maxPhred
+	}
+	q := int(math.Round(-10 * math.Log10(1-p)))
+	if q > maxPhred {
+		return maxPhred
+	}
+	return q
+}
+
+// PhredChar is the Sanger (offset 33) fastq character for a quality
+func PhredChar(q int) byte {
+	return byte(q + 33)
+}
+
+// SingleMoleculeSequence is one read's site calls laid out in reference coordinates, Start and End are the first and
+// last called sites (inclusive), positions in between without a call are N with quality 0
+type SingleMoleculeSequence struct {
+	ReadLabel string
+	Start     int
+	End       int
+	Seq       string
+	Qual      string
+}
+
+// SingleMoleculeSequenceConstruct builds a sequence from one read's worth of calls, as returned by
+// CallSingleMoleculeCanonicalVariants. Returns nil if none of the sites were called
+func SingleMoleculeSequenceConstruct(readCalls []*VariantCall) *SingleMoleculeSequence {
+	called := make([]*VariantCall, 0, len(readCalls))
+	for _, vc := range readCalls {
+		if vc.Call != "" {
+			called = append(called, vc)
+		}
+	}
+	if len(called) == 0 {
+		return nil
+	}
+	sort.Slice(called, func(i, j int) bool { return called[i].RefPos < called[j].RefPos })
+	start := called[0].RefPos
+	end := called[len(called)-1].RefPos
+	seq := make([]byte, end-start+1)
+	qual := make([]byte, end-start+1)
+	for i := range seq {
+		seq[i] = 'N'
+		qual[i] = PhredChar(0)
+	}
+	for _, vc := range called {
+		seq[vc.RefPos-start] = vc.Call[0]
+		qual[vc.RefPos-start] = PhredChar(ProbToPhred(vc.Prob))
+	}
+	return &SingleMoleculeSequence{ReadLabel: called[0].ReadLabel, Start: start, End: end, Seq: string(seq),
+		Qual: string(qual)}
+}
@@ -0,0 +1,31 @@
+package VClr
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbToPhred(t *testing.T) {
+	assert.True(t, ProbToPhred(0.9) == 10)
+	assert.True(t, ProbToPhred(0.999) == 30)
+	assert.True(t, ProbToPhred(1.0) == maxPhred)
+	assert.True(t, ProbToPhred(math.Inf(-1)) == 0)
+	assert.True(t, PhredChar(10) == '+')
+}
+
+func TestSingleMoleculeSequenceConstruct(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t3\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t5\tC\t0.5\tt\tforward\tr1\n" +
+		"ref\t5\tG\t0.5\tt\tforward\tr1\n" +
+		"ref\t6\tT\t0.1\tt\tforward\tr1\n")
+	results := CallSingleMoleculeCanonicalVariants(vca, ThresholdPolicyConstruct(0.2))
+	assert.True(t, len(results) == 1)
+	smSeq := SingleMoleculeSequenceConstruct(results[0])
+	// site 6 is below the threshold so isn't called
+	assert.True(t, smSeq.Start == 3 && smSeq.End == 5)
+	assert.True(t, smSeq.Seq[0] == 'A' && smSeq.Seq[1] == 'N')
+	assert.True(t, smSeq.Qual[0] == PhredChar(maxPhred) && smSeq.Qual[1] == PhredChar(0))
+	assert.True(t, smSeq.Qual[2] == PhredChar(3))
+}
@@ -4,6 +4,7 @@ package VClr
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 )
 
@@ -103,3 +104,21 @@ func (fq *FqReader) Iter() (record, bool) {
 	}
 	return fq.rec, fq.finished // incomplete fastq quality, return what we have
 }
+
+
+// WriteFasta writes a fasta record with the sequence wrapped at width characters
+func WriteFasta(w io.Writer, name, seq string, width int) {
+	fmt.Fprintf(w, ">%v\n", name)
+	for i := 0; i < len(seq); i += width {
+		end := i + width
+		if end > len(seq) {
+			end = len(seq)
+		}
+		fmt.Fprintf(w, "%v\n", seq[i:end])
+	}
+}
+
+// WriteFastq writes a four line fastq record
+func WriteFastq(w io.Writer, name, seq, qual string) {
+	fmt.Fprintf(w, "@%v\n%v\n+\n%v\n", name, seq, qual)
+}
@@ -0,0 +1,176 @@
+package VClr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Feature is a genomic interval, Start is 0-based and End is exclusive (BED coordinates)
+type Feature struct {
+	Chrom  string
+	Start  int
+	End    int
+	Name   string
+	Type   string
+	Strand string
+}
+
+func (self Feature) String() string {
+	return fmt.Sprintf("%v:%v-%v %v", self.Chrom, self.Start, self.End, self.Name)
+}
+
+// ParseBed reads the first six columns of a BED file (name and strand are optional), header and comment lines are
+// skipped. VClr works on one reference so the chromosome is kept but not used for matching
+func ParseBed(file io.Reader) []*Feature {
+	features := make([]*Feature, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") ||
+			strings.HasPrefix(line, "browser") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			panic(fmt.Sprintf("ParseBed: malformed line %v", line))
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		end, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			panic(fmt.Sprintf("ParseBed: bad coordinates in line %v", line))
+		}
+		f := &Feature{Chrom: fields[0], Start: start, End: end, Name: fmt.Sprintf("%v:%v-%v", fields[0], start, end),
+			Type: "region", Strand: "."}
+		if len(fields) > 3 {
+			f.Name = fields[3]
+		}
+		if len(fields) > 5 {
+			f.Strand = fields[5]
+		}
+		features = append(features, f)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(fmt.Sprintf("ParseBed: %v", err))
+	}
+	return features
+}
+
+// gff3Name picks a name for a feature from the attributes column
+func gff3Name(attributes string) string {
+	values := make(map[string]string)
+	for _, kv := range strings.Split(attributes, ";") {
+		parts := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	for _, key := range []string{"Name", "gene", "locus_tag", "ID"} {
+		if v, ok := values[key]; ok {
+			return v
+		}
+	}
+	return "."
+}
+
+// ParseGff3 reads a GFF3 file, converting the 1-based inclusive coordinates to BED coordinates. Reading stops at an
+// embedded ##FASTA section
+func ParseGff3(file io.Reader) []*Feature {
+	features := make([]*Feature, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "##FASTA") {
+			break
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 9 {
+			panic(fmt.Sprintf("ParseGff3: malformed line %v", line))
+		}
+		start, err1 := strconv.Atoi(fields[3])
+		end, err2 := strconv.Atoi(fields[4])
+		if err1 != nil || err2 != nil {
+			panic(fmt.Sprintf("ParseGff3: bad coordinates in line %v", line))
+		}
+		features = append(features, &Feature{Chrom: fields[0], Start: start - 1, End: end, Name: gff3Name(fields[8]),
+			Type: fields[2], Strand: fields[6]})
+	}
+	if err := scanner.Err(); err != nil {
+		panic(fmt.Sprintf("ParseGff3: %v", err))
+	}
+	return features
+}
+
+// FeatureIndex finds the features overlapping a position
+type FeatureIndex struct {
+	features  []*Feature
+	maxLength int
+	// maxEnd[i] is the index of the feature with the furthest end out of features[0:i+1]
+	maxEnd []int
+}
+
+func FeatureIndexConstruct(features []*Feature) *FeatureIndex {
+	sorted := make([]*Feature, len(features))
+	copy(sorted, features)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	maxLength := 0
+	maxEnd := make([]int, len(sorted))
+	for i, f := range sorted {
+		if f.End-f.Start > maxLength {
+			maxLength = f.End - f.Start
+		}
+		maxEnd[i] = i
+		if i > 0 && sorted[maxEnd[i-1]].End > f.End {
+			maxEnd[i] = maxEnd[i-1]
+		}
+	}
+	return &FeatureIndex{features: sorted, maxLength: maxLength, maxEnd: maxEnd}
+}
+
+// Nearest returns the closest feature to pos and the distance to it (0 if it overlaps), or nil if there are no
+// features
+func (self *FeatureIndex) Nearest(pos int) (*Feature, int) {
+	overlapping := self.Overlapping(pos)
+	if len(overlapping) > 0 {
+		return overlapping[0], 0
+	}
+	var nearest *Feature = nil
+	distance := 0
+	i := sort.Search(len(self.features), func(i int) bool { return self.features[i].Start > pos })
+	if i < len(self.features) {
+		nearest = self.features[i]
+		distance = nearest.Start - pos
+	}
+	if i > 0 {
+		upstream := self.features[self.maxEnd[i-1]]
+		if nearest == nil || pos-(upstream.End-1) < distance {
+			nearest = upstream
+			distance = pos - (upstream.End - 1)
+		}
+	}
+	return nearest, distance
+}
+
+// Overlapping returns the features containing pos, in order of their start
+func (self *FeatureIndex) Overlapping(pos int) []*Feature {
+	// first feature starting after pos, nothing before it can start earlier than pos - maxLength and still overlap
+	i := sort.Search(len(self.features), func(i int) bool { return self.features[i].Start > pos })
+	overlapping := make([]*Feature, 0)
+	for j := i - 1; j >= 0 && self.features[j].Start >= pos-self.maxLength; j-- {
+		if self.features[j].End > pos {
+			overlapping = append(overlapping, self.features[j])
+		}
+	}
+	// reverse so the features are in order
+	for a, b := 0, len(overlapping)-1; a < b; a, b = a+1, b-1 {
+		overlapping[a], overlapping[b] = overlapping[b], overlapping[a]
+	}
+	return overlapping
+}
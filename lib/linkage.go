@@ -0,0 +1,137 @@
+package VClr
+
+import (
+	"math"
+	"sort"
+)
+
+// methylState converts a single molecule call into methylated or not. Calls from CallSingleMoleculeMethylation are
+// bases, calls from CallSingleMoleculeGatcMethylation are motif states. No calls, unclassified and hemi-methylated
+// motifs are not informative
+func methylState(call string) (bool, bool) {
+	switch {
+	case call == "" || call == "unclassified" || call == "hemi-methylated":
+		return false, false
+	case call == "methylated" || isMethylBase(call):
+		return true, true
+	default:
+		return false, true
+	}
+}
+
+// SiteLinkage counts the reads covering a pair of sites by their methylation state at each, NMU is methylated at
+// SiteA and unmethylated at SiteB
+type SiteLinkage struct {
+	SiteA int
+	SiteB int
+	NMM   int
+	NMU   int
+	NUM   int
+	NUU   int
+}
+
+func SiteLinkageConstruct(siteA, siteB int) *SiteLinkage {
+	return &SiteLinkage{SiteA: siteA, SiteB: siteB, NMM: 0, NMU: 0, NUM: 0, NUU: 0}
+}
+
+func (self *SiteLinkage) AddRead(methylA, methylB bool) {
+	switch {
+	case methylA && methylB:
+		self.NMM += 1
+	case methylA:
+		self.NMU += 1
+	case methylB:
+		self.NUM += 1
+	default:
+		self.NUU += 1
+	}
+}
+
+func (self *SiteLinkage) NumberOfInformativeReads() int {
+	return self.NMM + self.NMU + self.NUM + self.NUU
+}
+
+// frequencies returns P(methylated at A), P(methylated at B) and the linkage disequilibrium D
+func (self *SiteLinkage) frequencies() (float64, float64, float64) {
+	n := float64(self.NumberOfInformativeReads())
+	pA := float64(self.NMM+self.NMU) / n
+	pB := float64(self.NMM+self.NUM) / n
+	d := float64(self.NMM)/n - pA*pB
+	return pA, pB, d
+}
+
+// RSquared is the squared correlation between the methylation states of the two sites, NaN if either site is
+// always in the same state
+func (self *SiteLinkage) RSquared() float64 {
+	pA, pB, d := self.frequencies()
+	denominator := pA * (1 - pA) * pB * (1 - pB)
+	if denominator == 0 {
+		return math.NaN()
+	}
+	return d * d / denominator
+}
+
+// DPrime is D normalized by its maximum given the marginal frequencies, NaN if either site is always in the same
+// state
+func (self *SiteLinkage) DPrime() float64 {
+	pA, pB, d := self.frequencies()
+	var dMax float64
+	if d >= 0 {
+		dMax = math.Min(pA*(1-pB), (1-pA)*pB)
+	} else {
+		dMax = math.Min(pA*pB, (1-pA)*(1-pB))
+	}
+	if dMax == 0 {
+		return math.NaN()
+	}
+	return d / dMax
+}
+
+type stateCall struct {
+	site       int
+	methylated bool
+}
+
+// CoMethylation counts, for every pair of sites at most maxDistance apart, the methylation states of the reads that
+// are informative at both. readCalls is one read's worth of calls per element, as returned by
+// CallSingleMoleculeMethylation or CallSingleMoleculeGatcMethylation. Pairs with fewer than minReads informative
+// reads are dropped, the results are sorted by site
+func CoMethylation(readCalls [][]*VariantCall, maxDistance, minReads int) []*SiteLinkage {
+	pairs := make(map[[2]int]*SiteLinkage)
+	for _, calls := range readCalls {
+		states := make([]stateCall, 0, len(calls))
+		for _, vc := range calls {
+			methylated, informative := methylState(vc.Call)
+			if informative {
+				states = append(states, stateCall{site: vc.RefPos, methylated: methylated})
+			}
+		}
+		sort.Slice(states, func(i, j int) bool { return states[i].site < states[j].site })
+		for i := 0; i < len(states); i++ {
+			for j := i + 1; j < len(states) && states[j].site-states[i].site <= maxDistance; j++ {
+				if states[j].site == states[i].site {
+					continue
+				}
+				key := [2]int{states[i].site, states[j].site}
+				_, check := pairs[key]
+				if !check {
+					pairs[key] = SiteLinkageConstruct(key[0], key[1])
+				}
+				pairs[key].AddRead(states[i].methylated, states[j].methylated)
+			}
+		}
+	}
+	results := make([]*SiteLinkage, 0, len(pairs))
+	for _, l := range pairs {
+		if l.NumberOfInformativeReads() >= minReads {
+			results = append(results, l)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].SiteA != results[j].SiteA {
+			return results[i].SiteA < results[j].SiteA
+		}
+		return results[i].SiteB < results[j].SiteB
+	})
+	return results
+}
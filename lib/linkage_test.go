@@ -0,0 +1,41 @@
+package VClr
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoMethylation(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t2\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t8\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t2\tI\t0.9\tt\tforward\tr2\n" +
+		"ref\t8\tI\t0.9\tt\tforward\tr2\n" +
+		"ref\t2\tA\t0.9\tt\tforward\tr3\n" +
+		"ref\t8\tA\t0.9\tt\tforward\tr3\n" +
+		"ref\t500\tA\t0.9\tt\tforward\tr3\n" +
+		"ref\t2\tA\t0.9\tt\tforward\tr4\n" +
+		"ref\t8\tA\t0.9\tt\tforward\tr4\n")
+	results := CoMethylation(CallSingleMoleculeMethylation(vca, ThresholdPolicyConstruct(0.0)), 100, 1)
+	// 500 is too far away to pair with anything
+	assert.True(t, len(results) == 1)
+	l := results[0]
+	assert.True(t, l.SiteA == 2 && l.SiteB == 8 && l.NumberOfInformativeReads() == 4)
+	assert.True(t, l.NMM == 2 && l.NUU == 2)
+	// perfectly linked
+	assert.InDelta(t, 1.0, l.RSquared(), 1e-9)
+	assert.InDelta(t, 1.0, l.DPrime(), 1e-9)
+
+	assert.True(t, len(CoMethylation(CallSingleMoleculeMethylation(vca, ThresholdPolicyConstruct(0.0)), 100, 5)) == 0)
+
+	independent := SiteLinkageConstruct(0, 1)
+	independent.AddRead(true, true)
+	independent.AddRead(true, false)
+	independent.AddRead(false, true)
+	independent.AddRead(false, false)
+	assert.InDelta(t, 0.0, independent.RSquared(), 1e-9)
+	allMethyl := SiteLinkageConstruct(0, 1)
+	allMethyl.AddRead(true, true)
+	assert.True(t, math.IsNaN(allMethyl.RSquared()))
+}
@@ -0,0 +1,110 @@
+package VClr
+
+import (
+	"math"
+	"sort"
+)
+
+// llrPseudocount keeps the log-likelihood ratio finite when all of the probability is on one side
+const llrPseudocount = 1e-6
+
+// MethylPosterior is the total probability on the modified bases for a normalized distribution over bases, NaN if
+// the site wasn't called (probs is empty)
+func MethylPosterior(probs map[string]float64) float64 {
+	if len(probs) == 0 {
+		return math.NaN()
+	}
+	var pMethyl float64 = 0.0
+	for base, p := range probs {
+		if isMethylBase(base) {
+			pMethyl += p
+		}
+	}
+	return pMethyl
+}
+
+// MethylLogLikelihoodRatio is log(P(modified)/P(canonical)) for a normalized distribution over bases, NaN if the
+// site wasn't called (probs is empty)
+func MethylLogLikelihoodRatio(probs map[string]float64) float64 {
+	if len(probs) == 0 {
+		return math.NaN()
+	}
+	pMethyl := MethylPosterior(probs)
+	pCanonical := 1.0 - pMethyl
+	return math.Log(pMethyl+llrPseudocount) - math.Log(pCanonical+llrPseudocount)
+}
+
+// MethylSiteCall is a call at one site on one strand of one read
+type MethylSiteCall struct {
+	ReadLabel string
+	Strand    string
+	RefPos    int
+	Call      string
+	Prob      float64
+	Llr       float64
+	ReadScore float64
+}
+
+func MethylSiteCallConstruct(readLabel, strand string, refPos int, call string, prob, llr,
+	readScore float64) *MethylSiteCall {
+	return &MethylSiteCall{ReadLabel: readLabel, Strand: strand, RefPos: refPos, Call: call, Prob: prob, Llr: llr,
+		ReadScore: readScore}
+}
+
+// CallSingleMoleculeMethylationSites calls every site on each strand of each read, keeping the probability of the
+// call and the log-likelihood ratio of modified vs canonical. The read score is for the strand. The results are
+// sorted by read, strand and site
+func CallSingleMoleculeMethylationSites(alignment *VcAlignment, threshold *ThresholdPolicy) []*MethylSiteCall {
+	results := make([]*MethylSiteCall, 0)
+	for readLabel, readAln := range alignment.GroupByRead() {
+		for strand, strandAln := range readAln.GroupByStrand() {
+			readScore := strandAln.ScoreRead()
+			for site, alignedPairs := range strandAln.GroupBySite() {
+				probs := alignedPairs.SiteProbsOnStrand(threshold)
+				call, prob := argmaxProb(probs)
+				llr := MethylLogLikelihoodRatio(probs)
+				results = append(results, MethylSiteCallConstruct(readLabel, strand, site, call, prob, llr, readScore))
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.ReadLabel != b.ReadLabel {
+			return a.ReadLabel < b.ReadLabel
+		}
+		if a.Strand != b.Strand {
+			return a.Strand > b.Strand  // template first
+		}
+		return a.RefPos < b.RefPos
+	})
+	return results
+}
+
+// SingleMoleculeSiteCallsByLlr is like SingleMoleculeSiteCalls but only calls a read at a site when the
+// log-likelihood ratio is beyond the cutoff, see SiteCallStats.AddLlrCall
+func SingleMoleculeSiteCallsByLlr(alignment *VcAlignment, threshold *ThresholdPolicy,
+	cutoff float64) map[int]*SiteCallStats {
+	siteCalls := make(map[int]*SiteCallStats)
+	for _, readDf := range alignment.GroupByRead() {
+		for site, siteDf := range readDf.GroupBySite() {
+			probs := siteDf.SiteProbsOnStrand(threshold)
+			_, check := siteCalls[site]
+			if !check {
+				siteCalls[site] = SiteCallStatsConstruct()
+			}
+			siteCalls[site].AddLlrCall(MethylLogLikelihoodRatio(probs), cutoff)
+			siteCalls[site].AddPosterior(MethylPosterior(probs))
+		}
+	}
+	return siteCalls
+}
+
+// LlrCallStats tallies a set of calls (for example all of the sites on one strand of a read) by their
+// log-likelihood ratios
+func LlrCallStats(calls []*MethylSiteCall, cutoff float64) *SiteCallStats {
+	stats := SiteCallStatsConstruct()
+	for _, mc := range calls {
+		stats.AddLlrCall(mc.Llr, cutoff)
+	}
+	return stats
+}
@@ -0,0 +1,97 @@
+package VClr
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethylLogLikelihoodRatio(t *testing.T) {
+	assert.InDelta(t, math.Log(3), MethylLogLikelihoodRatio(map[string]float64{"I": 0.75, "A": 0.25}), 1e-5)
+	assert.InDelta(t, -math.Log(4), MethylLogLikelihoodRatio(map[string]float64{"E": 0.2, "C": 0.8}), 1e-5)
+	assert.True(t, MethylLogLikelihoodRatio(map[string]float64{"I": 1.0}) > 10)
+	assert.True(t, math.IsNaN(MethylLogLikelihoodRatio(map[string]float64{})))
+}
+
+func TestCallSingleMoleculeMethylationSites(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t5\tI\t0.6\tt\tforward\tr1\n" +
+		"ref\t5\tA\t0.2\tt\tforward\tr1\n" +
+		"ref\t1\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t1\tI\t0.3\tc\tforward\tr1\n" +
+		"ref\t1\tA\t0.8\tt\tforward\tr0\n")
+	results := CallSingleMoleculeMethylationSites(vca, ThresholdPolicyConstruct(0.0))
+	assert.True(t, len(results) == 4)
+	assert.True(t, results[0].ReadLabel == "r0")
+	assert.True(t, results[1].ReadLabel == "r1" && results[1].Strand == "t" && results[1].RefPos == 1)
+	assert.True(t, results[2].RefPos == 5 && results[2].Call == "I")
+	assert.InDelta(t, 0.75, results[2].Prob, 1e-9)
+	assert.InDelta(t, math.Log(3), results[2].Llr, 1e-5)
+	assert.InDelta(t, 100*(0.6+0.2+0.9)/3, results[2].ReadScore, 1e-9)
+	assert.True(t, results[3].Strand == "c" && results[3].Call == "I")
+}
+
+func TestSingleMoleculeSiteCallsByLlr(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t5\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t5\tA\t0.1\tt\tforward\tr1\n" +
+		"ref\t5\tI\t0.51\tt\tforward\tr2\n" +
+		"ref\t5\tA\t0.49\tt\tforward\tr2\n" +
+		"ref\t5\tA\t0.95\tt\tforward\tr3\n" +
+		"ref\t5\tI\t0.05\tt\tforward\tr3\n")
+	siteCalls := SingleMoleculeSiteCallsByLlr(vca, ThresholdPolicyConstruct(0.0), 1.0)
+	stats := siteCalls[5]
+	// r2 is a near tie so it's ambiguous
+	assert.True(t, stats.NumberOfCalls() == 2)
+	assert.True(t, stats.NumberOfMethylatedCalls() == 1)
+	assert.True(t, stats.NumberOfAmbiguousCalls() == 1)
+	assert.InDelta(t, 50.0, stats.PercentMethylatedCalls(), 1e-9)
+	// the hard calls count the near tie as methylated
+	assert.True(t, SingleMoleculeSiteCalls(vca, ThresholdPolicyConstruct(0.0))[5].NumberOfMethylatedCalls() == 2)
+}
+
+func TestSiteCallStats_PosteriorInterval(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t5\tI\t0.8\tt\tforward\tr1\n" +
+		"ref\t5\tA\t0.2\tt\tforward\tr1\n" +
+		"ref\t5\tI\t0.6\tt\tforward\tr2\n" +
+		"ref\t5\tA\t0.4\tt\tforward\tr2\n" +
+		"ref\t5\tI\t0.1\tt\tforward\tr3\n" +
+		"ref\t5\tA\t0.9\tt\tforward\tr3\n")
+	stats := SiteMethylationStats(vca, ThresholdPolicyConstruct(0.0))
+	assert.True(t, stats.NumberOfPosteriors() == 3)
+	assert.InDelta(t, 50.0, stats.PosteriorPercentMethylated(), 1e-9)
+	lo, hi := stats.PosteriorInterval(0.05)
+	// sd of (0.8, 0.6, 0.1) is 0.3606
+	assert.InDelta(t, 100*(0.5-1.959964*0.360555/math.Sqrt(3)), lo, 1e-3)
+	assert.InDelta(t, 100*(0.5+1.959964*0.360555/math.Sqrt(3)), hi, 1e-3)
+	// the same estimate comes out when grouping by read first
+	siteCalls := SingleMoleculeSiteCalls(vca, ThresholdPolicyConstruct(0.0))
+	assert.InDelta(t, 50.0, siteCalls[5].PosteriorPercentMethylated(), 1e-9)
+
+	single := SiteCallStatsConstruct()
+	single.AddPosterior(0.9)
+	lo, _ = single.PosteriorInterval(0.05)
+	assert.True(t, math.IsNaN(lo))
+}
+
+func TestSiteCallStats_NoCalls(t *testing.T) {
+	// r2 and r3 don't have anything above the threshold
+	vca := alignmentFromString(
+		"ref\t5\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t5\tA\t0.1\tt\tforward\tr1\n" +
+		"ref\t5\tI\t0.3\tt\tforward\tr2\n" +
+		"ref\t5\tA\t0.3\tt\tforward\tr2\n" +
+		"ref\t5\tI\t0.4\tt\tforward\tr3\n" +
+		"ref\t5\tA\t0.2\tt\tforward\tr3\n" +
+		"ref\t5\tI\t0.2\tt\tforward\tr4\n" +
+		"ref\t5\tA\t0.8\tt\tforward\tr4\n")
+	threshold := ThresholdPolicyConstruct(0.5)
+	for _, stats := range []*SiteCallStats{SiteMethylationStats(vca, threshold),
+		SingleMoleculeSiteCalls(vca, threshold)[5]} {
+		assert.True(t, stats.NumberOfCalls() == 2, "got %v calls", stats.NumberOfCalls())
+		assert.True(t, stats.NumberOfPosteriors() == 2)
+		assert.InDelta(t, 50.0, stats.PercentMethylatedCalls(), 1e-9)
+		assert.InDelta(t, 50.0, stats.PosteriorPercentMethylated(), 1e-9)
+	}
+}
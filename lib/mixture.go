@@ -0,0 +1,131 @@
+package VClr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// GaussianMixture is a two component normal mixture, component 0 has the lower mean ("junk") and component 1 the
+// higher mean ("good")
+type GaussianMixture struct {
+	Weights       [2]float64
+	Means         [2]float64
+	StdDevs       [2]float64
+	LogLikelihood float64
+	Iterations    int
+}
+
+func normalLogPdf(x, mean, sd float64) float64 {
+	z := (x - mean) / sd
+	return -0.5*z*z - math.Log(sd) - 0.5*math.Log(2*math.Pi)
+}
+
+// componentLogDensities are log(weight * pdf) for each component
+func (self *GaussianMixture) componentLogDensities(x float64) (float64, float64) {
+	return math.Log(self.Weights[0]) + normalLogPdf(x, self.Means[0], self.StdDevs[0]),
+		math.Log(self.Weights[1]) + normalLogPdf(x, self.Means[1], self.StdDevs[1])
+}
+
+// PosteriorGood is the probability that x came from the higher component
+func (self *GaussianMixture) PosteriorGood(x float64) float64 {
+	l0, l1 := self.componentLogDensities(x)
+	return 1 / (1 + math.Exp(l0-l1))
+}
+
+// Cutoff is the value between the two means where PosteriorGood reaches posterior, found by bisection. It is the
+// lower mean if the posterior is already reached there and the higher mean if it isn't reached by then
+func (self *GaussianMixture) Cutoff(posterior float64) float64 {
+	lo, hi := self.Means[0], self.Means[1]
+	if self.PosteriorGood(lo) >= posterior {
+		return lo
+	}
+	if self.PosteriorGood(hi) < posterior {
+		return hi
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if self.PosteriorGood(mid) < posterior {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi
+}
+
+func (self GaussianMixture) String() string {
+	return fmt.Sprintf("junk: weight %.4f mean %.4f sd %.4f, good: weight %.4f mean %.4f sd %.4f, "+
+		"log-likelihood %.4f after %v iterations", self.Weights[0], self.Means[0], self.StdDevs[0], self.Weights[1],
+		self.Means[1], self.StdDevs[1], self.LogLikelihood, self.Iterations)
+}
+
+// FitGaussianMixture fits two normals to values by expectation maximization, starting from the lower and upper
+// halves of the sorted values. Standard deviations are kept above a small fraction of the range of values so a
+// component can't collapse onto a single point. Needs at least 2 values
+func FitGaussianMixture(values []float64, maxIterations int) *GaussianMixture {
+	n := len(values)
+	if n < 2 {
+		panic(fmt.Sprintf("FitGaussianMixture: need at least 2 values, got %v", n))
+	}
+	sorted := make([]float64, n)
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	minSd := math.Max(1e-6, 1e-3*(sorted[n-1]-sorted[0]))
+	lower := sorted[:n/2]
+	upper := sorted[n/2:]
+	mixture := &GaussianMixture{Weights: [2]float64{0.5, 0.5}, Means: [2]float64{meanFloat(lower), meanFloat(upper)}}
+	for k, half := range [][]float64{lower, upper} {
+		sd := minSd
+		if len(half) > 1 {
+			sd = math.Max(minSd, stdDevFloat(half))
+		}
+		mixture.StdDevs[k] = sd
+	}
+
+	resp := make([]float64, n)
+	previous := math.Inf(-1)
+	for iteration := 1; iteration <= maxIterations; iteration++ {
+		// E step, resp is the posterior of the good component
+		logLikelihood := 0.0
+		for i, x := range values {
+			l0, l1 := mixture.componentLogDensities(x)
+			m := math.Max(l0, l1)
+			logSum := m + math.Log(math.Exp(l0-m)+math.Exp(l1-m))
+			resp[i] = math.Exp(l1 - logSum)
+			logLikelihood += logSum
+		}
+		mixture.LogLikelihood = logLikelihood
+		mixture.Iterations = iteration
+		if math.Abs(logLikelihood-previous) < 1e-8*math.Abs(logLikelihood) {
+			break
+		}
+		previous = logLikelihood
+		// M step
+		var sumR, sumRX, sumX float64
+		for i, x := range values {
+			sumR += resp[i]
+			sumRX += resp[i] * x
+			sumX += x
+		}
+		if sumR < 1e-12 || float64(n)-sumR < 1e-12 {
+			// one component has nothing left
+			break
+		}
+		mixture.Weights = [2]float64{1 - sumR/float64(n), sumR / float64(n)}
+		mixture.Means = [2]float64{(sumX - sumRX) / (float64(n) - sumR), sumRX / sumR}
+		var ss0, ss1 float64
+		for i, x := range values {
+			ss0 += (1 - resp[i]) * (x - mixture.Means[0]) * (x - mixture.Means[0])
+			ss1 += resp[i] * (x - mixture.Means[1]) * (x - mixture.Means[1])
+		}
+		mixture.StdDevs = [2]float64{math.Max(minSd, math.Sqrt(ss0/(float64(n)-sumR))),
+			math.Max(minSd, math.Sqrt(ss1/sumR))}
+	}
+	if mixture.Means[0] > mixture.Means[1] {
+		mixture.Weights[0], mixture.Weights[1] = mixture.Weights[1], mixture.Weights[0]
+		mixture.Means[0], mixture.Means[1] = mixture.Means[1], mixture.Means[0]
+		mixture.StdDevs[0], mixture.StdDevs[1] = mixture.StdDevs[1], mixture.StdDevs[0]
+	}
+	return mixture
+}
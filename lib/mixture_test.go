@@ -0,0 +1,46 @@
+package VClr
+
+import (
+	"math/rand"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFitGaussianMixture(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := make([]float64, 0)
+	for i := 0; i < 300; i++ {
+		values = append(values, 85+4*rng.NormFloat64())
+	}
+	for i := 0; i < 100; i++ {
+		values = append(values, 55+8*rng.NormFloat64())
+	}
+	mixture := FitGaussianMixture(values, 500)
+	assert.InDelta(t, 55.0, mixture.Means[0], 2.0)
+	assert.InDelta(t, 85.0, mixture.Means[1], 1.0)
+	assert.InDelta(t, 8.0, mixture.StdDevs[0], 1.5)
+	assert.InDelta(t, 4.0, mixture.StdDevs[1], 1.0)
+	assert.InDelta(t, 0.75, mixture.Weights[1], 0.05)
+
+	cutoff := mixture.Cutoff(0.5)
+	assert.True(t, cutoff > 65 && cutoff < 80)
+	assert.InDelta(t, 0.5, mixture.PosteriorGood(cutoff), 1e-6)
+	assert.True(t, mixture.Cutoff(0.99) > cutoff)
+	assert.True(t, mixture.PosteriorGood(90) > 0.99 && mixture.PosteriorGood(50) < 0.01)
+}
+
+func TestFilterByStrandReadScore(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t10\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t10\tA\t0.6\tc\tbackward\tr1\n" +
+		"ref\t10\tA\t0.5\tt\tforward\tr2\n" +
+		"ref\t10\tA\t0.7\tc\tbackward\tr2\n")
+	scores := ReadScoresByStrand(vca)
+	assert.True(t, len(scores["t"]) == 2 && len(scores["c"]) == 2)
+	filtered := vca.FilterByStrandReadScore(map[string]float64{"t": 80, "c": 65})
+	assert.True(t, len(filtered.Records) == 2)
+	byStrand := filtered.GroupByStrand()
+	assert.True(t, len(byStrand["t"].Records) == 1 && byStrand["t"].Records[0].readLabel == "r1")
+	assert.True(t, len(byStrand["c"].Records) == 1 && byStrand["c"].Records[0].readLabel == "r2")
+	assert.True(t, len(vca.FilterByStrandReadScore(map[string]float64{"t": 80}).Records) == 3)
+}
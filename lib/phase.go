@@ -0,0 +1,188 @@
+package VClr
+
+import (
+	"sort"
+	"strings"
+)
+
+// PhasedSite is a variant site, Haplotype is the allele (0 ref, 1 alt) on the first haplotype and Block is the
+// position of the first site in its phase block (Block == RefPos and BlockSize 1 for sites that couldn't be phased)
+type PhasedSite struct {
+	RefPos    int
+	Ref       string
+	Alt       string
+	Coverage  int
+	Prob      float64
+	Haplotype int
+	Block     int
+	BlockSize int
+}
+
+// ReadHaplotype is a read's assignment to a haplotype (1 or 2, 0 if it agrees with neither more than the other)
+type ReadHaplotype struct {
+	ReadLabel string
+	Block     int
+	Haplotype int
+	NSites    int
+	NAgree    int
+}
+
+// Phasing is the result of PhaseVariants
+type Phasing struct {
+	Sites []*PhasedSite
+	Reads []*ReadHaplotype
+}
+
+// VariantSites calls every site with CallSite and keeps the ones where the call is a canonical base that differs
+// from the reference, with at least minCoverage reads and call probability minProb
+func VariantSites(alignment *VcAlignment, threshold *ThresholdPolicy, reference string, minCoverage int,
+	minProb float64) []*PhasedSite {
+	sites := make([]*PhasedSite, 0)
+	for site, aln := range alignment.GroupBySite() {
+		if site < 0 || site >= len(reference) {
+			continue
+		}
+		call, coverage, prob := CallSite(aln, threshold)
+		refBase := strings.ToUpper(string(reference[site]))
+		if !isCanonicalBase(call) || call == refBase || coverage < minCoverage || prob < minProb {
+			continue
+		}
+		sites = append(sites, &PhasedSite{RefPos: site, Ref: refBase, Alt: call, Coverage: coverage, Prob: prob,
+			Haplotype: 1, Block: site, BlockSize: 1})
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].RefPos < sites[j].RefPos })
+	return sites
+}
+
+// readAlleles calls each read at the variant sites, map[read]map[site index]allele with 0 for the reference base
+// and 1 for the alternate, other calls are dropped
+func readAlleles(alignment *VcAlignment, sites []*PhasedSite, threshold *ThresholdPolicy) map[string]map[int]int {
+	siteIdx := make(map[int]int)
+	for i, s := range sites {
+		siteIdx[s.RefPos] = i
+	}
+	alleles := make(map[string]map[int]int)
+	for readLabel, readAln := range alignment.GroupByRead() {
+		for site, siteAln := range readAln.GroupBySite() {
+			i, isVariant := siteIdx[site]
+			if !isVariant {
+				continue
+			}
+			call, _ := siteAln.CallSiteOnCodingStrand(threshold)
+			var allele int
+			switch call {
+			case sites[i].Ref:
+				allele = 0
+			case sites[i].Alt:
+				allele = 1
+			default:
+				continue
+			}
+			_, check := alleles[readLabel]
+			if !check {
+				alleles[readLabel] = make(map[int]int)
+			}
+			alleles[readLabel][i] = allele
+		}
+	}
+	return alleles
+}
+
+// PhaseVariants builds phase blocks from reads covering more than one variant site. Sites are linked when reads
+// cover both, with a weight of +1 for each read with the same allele at both (cis) and -1 for each read with
+// different alleles (trans). Each connected set of sites is a block, phased greedily in breadth-first order by
+// putting each site's alternate allele on the haplotype that agrees with the most reads
+func PhaseVariants(alignment *VcAlignment, sites []*PhasedSite, threshold *ThresholdPolicy) *Phasing {
+	alleles := readAlleles(alignment, sites, threshold)
+	weights := make([]map[int]int, len(sites))
+	for i := range weights {
+		weights[i] = make(map[int]int)
+	}
+	for _, readAlleles := range alleles {
+		idx := make([]int, 0, len(readAlleles))
+		for i := range readAlleles {
+			idx = append(idx, i)
+		}
+		for a := 0; a < len(idx); a++ {
+			for b := a + 1; b < len(idx); b++ {
+				i, j := idx[a], idx[b]
+				w := -1
+				if readAlleles[i] == readAlleles[j] {
+					w = 1
+				}
+				weights[i][j] += w
+				weights[j][i] += w
+			}
+		}
+	}
+	visited := make([]bool, len(sites))
+	for start := range sites {
+		if visited[start] {
+			continue
+		}
+		// breadth first over the sites linked to start
+		visited[start] = true
+		sites[start].Haplotype = 1
+		order := []int{start}
+		for q := 0; q < len(order); q++ {
+			i := order[q]
+			neighbours := make([]int, 0, len(weights[i]))
+			for j := range weights[i] {
+				neighbours = append(neighbours, j)
+			}
+			sort.Ints(neighbours)
+			for _, j := range neighbours {
+				if visited[j] {
+					continue
+				}
+				// vote with every site already phased
+				vote := 0
+				for k, w := range weights[j] {
+					if !visited[k] {
+						continue
+					}
+					if sites[k].Haplotype == 1 {
+						vote += w
+					} else {
+						vote -= w
+					}
+				}
+				if vote >= 0 {
+					sites[j].Haplotype = 1
+				} else {
+					sites[j].Haplotype = 0
+				}
+				visited[j] = true
+				order = append(order, j)
+			}
+		}
+		block := sites[start].RefPos
+		for _, i := range order {
+			sites[i].Block = block
+			sites[i].BlockSize = len(order)
+		}
+	}
+
+	reads := make([]*ReadHaplotype, 0, len(alleles))
+	for readLabel, readAlleles := range alleles {
+		nAgree := 0
+		block := -1
+		for i, allele := range readAlleles {
+			block = sites[i].Block
+			if allele == sites[i].Haplotype {
+				nAgree += 1
+			}
+		}
+		haplotype := 0
+		switch {
+		case 2*nAgree > len(readAlleles):
+			haplotype = 1
+		case 2*nAgree < len(readAlleles):
+			haplotype = 2
+		}
+		reads = append(reads, &ReadHaplotype{ReadLabel: readLabel, Block: block, Haplotype: haplotype,
+			NSites: len(readAlleles), NAgree: nAgree})
+	}
+	sort.Slice(reads, func(i, j int) bool { return reads[i].ReadLabel < reads[j].ReadLabel })
+	return &Phasing{Sites: sites, Reads: reads}
+}
@@ -0,0 +1,57 @@
+package VClr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseVariants(t *testing.T) {
+	reference := strings.Repeat("A", 40)
+	table := ""
+	for _, r := range []string{"r1", "r2", "r3"} {
+		table += "ref\t10\tG\t0.9\tt\tforward\t" + r + "\n"
+		table += "ref\t20\tT\t0.9\tt\tforward\t" + r + "\n"
+	}
+	for _, r := range []string{"r4", "r5"} {
+		table += "ref\t10\tA\t0.9\tt\tforward\t" + r + "\n"
+		table += "ref\t20\tA\t0.9\tt\tforward\t" + r + "\n"
+		table += "ref\t30\tC\t0.9\tt\tforward\t" + r + "\n"
+	}
+	table += "ref\t30\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t30\tA\t0.9\tt\tforward\tr2\n" +
+		"ref\t30\tC\t0.9\tt\tforward\tr6\n" +
+		"ref\t35\tG\t0.9\tt\tforward\tr7\n" +
+		"ref\t12\tA\t0.9\tt\tforward\tr7\n"
+	vca := alignmentFromString(table)
+
+	sites := VariantSites(vca, ThresholdPolicyConstruct(0.0), reference, 1, 0.0)
+	assert.True(t, len(sites) == 4)
+	assert.True(t, sites[0].RefPos == 10 && sites[0].Alt == "G" && sites[0].Coverage == 5)
+	assert.True(t, len(VariantSites(vca, ThresholdPolicyConstruct(0.0), reference, 2, 0.0)) == 3)
+
+	phasing := PhaseVariants(vca, sites, ThresholdPolicyConstruct(0.0))
+	// the alternate alleles at 10 and 20 are in cis, the one at 30 is on the other haplotype
+	assert.Equal(t, []int{1, 1, 0, 1}, []int{sites[0].Haplotype, sites[1].Haplotype, sites[2].Haplotype,
+		sites[3].Haplotype})
+	assert.True(t, sites[0].Block == 10 && sites[2].Block == 10 && sites[2].BlockSize == 3)
+	assert.True(t, sites[3].Block == 35 && sites[3].BlockSize == 1)
+
+	assert.True(t, len(phasing.Reads) == 7)
+	haplotypes := make(map[string]int)
+	for _, r := range phasing.Reads {
+		haplotypes[r.ReadLabel] = r.Haplotype
+	}
+	assert.Equal(t, map[string]int{"r1": 1, "r2": 1, "r3": 1, "r4": 2, "r5": 2, "r6": 2, "r7": 1}, haplotypes)
+	assert.True(t, phasing.Reads[0].NSites == 3 && phasing.Reads[0].NAgree == 3)
+
+	var out bytes.Buffer
+	WritePhasedVcf(&out, "ref", "sample", sites)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, "ref\t11\t.\tA\tG\t.\tPASS\tDP=5\tGT:PS\t1|0:11", lines[len(lines)-4])
+	assert.Equal(t, "ref\t31\t.\tA\tC\t.\tPASS\tDP=5\tGT:PS\t0|1:11", lines[len(lines)-2])
+	assert.Equal(t, "ref\t36\t.\tA\tG\t.\tPASS\tDP=1\tGT\t0/1", lines[len(lines)-1])
+	_, records := ParseVcf(strings.NewReader(out.String()))
+	assert.True(t, len(records) == 4 && records[2].Genotypes[0] == "0|1")
+}
@@ -0,0 +1,172 @@
+package VClr
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// ReadStrandScore is one strand of a read with its ScoreRead and its percent accuracy (when there is a reference)
+// or percent methylated, Value is NaN when there aren't any calls
+type ReadStrandScore struct {
+	ReadLabel string
+	Strand    string
+	Score     float64
+	Value     float64
+	NCalls    int
+}
+
+// ReadStrandScores scores each strand of each read. With a reference the value is the percent of canonical calls
+// that match it, otherwise it is the percent of methylation calls that are methylated
+func ReadStrandScores(alignment *VcAlignment, threshold *ThresholdPolicy, reference string) []*ReadStrandScore {
+	scores := make([]*ReadStrandScore, 0)
+	for readLabel, readAln := range alignment.GroupByRead() {
+		for strand, strandAln := range readAln.GroupByStrand() {
+			var readCalls [][]*VariantCall
+			if reference != "" {
+				readCalls = CallSingleMoleculeCanonicalVariants(strandAln, threshold)
+			} else {
+				readCalls = CallSingleMoleculeMethylation(strandAln, threshold)
+			}
+			nCalls := 0
+			nHits := 0
+			for _, calls := range readCalls {
+				for _, vc := range calls {
+					if vc.Call == "" {
+						continue
+					}
+					if reference != "" {
+						if vc.RefPos < 0 || vc.RefPos >= len(reference) {
+							continue
+						}
+						if vc.Call == strings.ToUpper(string(reference[vc.RefPos])) {
+							nHits += 1
+						}
+					} else if isMethylBase(vc.Call) {
+						nHits += 1
+					}
+					nCalls += 1
+				}
+			}
+			value := math.NaN()
+			if nCalls > 0 {
+				value = 100 * float64(nHits) / float64(nCalls)
+			}
+			scores = append(scores, &ReadStrandScore{ReadLabel: readLabel, Strand: strand,
+				Score: strandAln.ScoreRead(), Value: value, NCalls: nCalls})
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].ReadLabel != scores[j].ReadLabel {
+			return scores[i].ReadLabel < scores[j].ReadLabel
+		}
+		return scores[i].Strand > scores[j].Strand
+	})
+	return scores
+}
+
+// ReadScoreBin has the reads with a score in [Lo, Hi) and the mean of their values
+type ReadScoreBin struct {
+	Lo        float64
+	Hi        float64
+	NReads    int
+	MeanValue float64
+}
+
+// BinReadScores puts the reads on strand with a value into bins of width, from the lowest to the highest score.
+// Empty bins are kept so the bins are contiguous
+func BinReadScores(scores []*ReadStrandScore, strand string, width float64) []*ReadScoreBin {
+	if width <= 0 {
+		panic("BinReadScores: width must be positive")
+	}
+	lo := math.Inf(1)
+	hi := math.Inf(-1)
+	for _, s := range scores {
+		if s.Strand != strand || math.IsNaN(s.Value) {
+			continue
+		}
+		lo = math.Min(lo, s.Score)
+		hi = math.Max(hi, s.Score)
+	}
+	bins := make([]*ReadScoreBin, 0)
+	if math.IsInf(lo, 1) {
+		return bins
+	}
+	start := math.Floor(lo/width) * width
+	nBins := int(math.Floor((hi-start)/width)) + 1
+	totals := make([]float64, nBins)
+	for i := 0; i < nBins; i++ {
+		bins = append(bins, &ReadScoreBin{Lo: start + float64(i)*width, Hi: start + float64(i+1)*width})
+	}
+	for _, s := range scores {
+		if s.Strand != strand || math.IsNaN(s.Value) {
+			continue
+		}
+		i := int(math.Floor((s.Score - start) / width))
+		if i >= nBins {
+			i = nBins - 1
+		}
+		bins[i].NReads += 1
+		totals[i] += s.Value
+	}
+	for i, b := range bins {
+		b.MeanValue = totals[i] / float64(b.NReads)
+	}
+	return bins
+}
+
+// RecommendReadScoreCutoff is the lowest score cutoff that keeps the mean value of the reads on strand at or above
+// target, along with that mean and the number of reads kept. The cutoff is NaN when no cutoff reaches the target
+func RecommendReadScoreCutoff(scores []*ReadStrandScore, strand string, target float64) (float64, float64, int) {
+	kept := make([]*ReadStrandScore, 0)
+	for _, s := range scores {
+		if s.Strand == strand && !math.IsNaN(s.Value) {
+			kept = append(kept, s)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Score > kept[j].Score })
+	cutoff := math.NaN()
+	mean := math.NaN()
+	nReads := 0
+	var total float64 = 0.0
+	for i, s := range kept {
+		total += s.Value
+		// only cut between reads with different scores
+		if i+1 < len(kept) && kept[i+1].Score == s.Score {
+			continue
+		}
+		if total/float64(i+1) >= target {
+			cutoff = s.Score
+			mean = total / float64(i+1)
+			nReads = i + 1
+		}
+	}
+	return cutoff, mean, nReads
+}
+
+// ReadScoresByStrand is the ScoreRead of every read on each strand
+func ReadScoresByStrand(alignment *VcAlignment) map[string][]float64 {
+	scores := make(map[string][]float64)
+	for _, readAln := range alignment.GroupByRead() {
+		for strand, strandAln := range readAln.GroupByStrand() {
+			scores[strand] = append(scores[strand], strandAln.ScoreRead())
+		}
+	}
+	return scores
+}
+
+// FilterByStrandReadScore applies FilterByReadScore to each strand with its own threshold, strands without a
+// threshold are kept as they are
+func (self *VcAlignment) FilterByStrandReadScore(thresholds map[string]float64) *VcAlignment {
+	filtered := VcAlignmentConstruct()
+	for strand, strandAln := range self.GroupByStrand() {
+		threshold, check := thresholds[strand]
+		if check {
+			strandAln = strandAln.FilterByReadScore(threshold)
+		}
+		for _, r := range strandAln.Records {
+			filtered.AddRecord(r)
+		}
+	}
+	return filtered
+}
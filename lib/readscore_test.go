@@ -0,0 +1,53 @@
+package VClr
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadStrandScores(t *testing.T) {
+	reference := "AAAAAAAAAAAAAAAAAAAA"
+	vca := alignmentFromString(
+		"ref\t10\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t11\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t10\tT\t0.9\tc\tbackward\tr1\n" +
+		"ref\t11\tA\t0.5\tc\tbackward\tr1\n" +
+		"ref\t10\tI\t0.6\tt\tforward\tr2\n" +
+		"ref\t11\tA\t0.6\tt\tforward\tr2\n")
+	scores := ReadStrandScores(vca, ThresholdPolicyConstruct(0.0), reference)
+	assert.True(t, len(scores) == 3)
+	assert.True(t, scores[0].ReadLabel == "r1" && scores[0].Strand == "t" && scores[1].Strand == "c")
+	assert.InDelta(t, 90.0, scores[0].Score, 1e-9)
+	assert.InDelta(t, 100.0, scores[0].Value, 1e-9)
+	assert.InDelta(t, 70.0, scores[1].Score, 1e-9)
+	assert.InDelta(t, 50.0, scores[1].Value, 1e-9)
+
+	methyl := ReadStrandScores(vca, ThresholdPolicyConstruct(0.0), "")
+	assert.InDelta(t, 50.0, methyl[2].Value, 1e-9)
+	assert.True(t, methyl[2].NCalls == 2)
+}
+
+func TestReadScoreBins(t *testing.T) {
+	scores := []*ReadStrandScore{
+		{ReadLabel: "r1", Strand: "t", Score: 92, Value: 98},
+		{ReadLabel: "r2", Strand: "t", Score: 88, Value: 96},
+		{ReadLabel: "r3", Strand: "t", Score: 81, Value: 90},
+		{ReadLabel: "r4", Strand: "t", Score: 71, Value: 70},
+		{ReadLabel: "r5", Strand: "t", Score: 50, Value: math.NaN()},
+		{ReadLabel: "r1", Strand: "c", Score: 60, Value: 80},
+	}
+	bins := BinReadScores(scores, "t", 10)
+	assert.True(t, len(bins) == 3)
+	assert.True(t, bins[0].Lo == 70 && bins[0].NReads == 1)
+	assert.True(t, bins[1].Lo == 80 && bins[1].NReads == 2)
+	assert.InDelta(t, 93.0, bins[1].MeanValue, 1e-9)
+	assert.True(t, bins[2].Hi == 100 && bins[2].NReads == 1)
+
+	cutoff, mean, n := RecommendReadScoreCutoff(scores, "t", 94)
+	assert.InDelta(t, 81.0, cutoff, 1e-9)
+	assert.InDelta(t, 284.0/3, mean, 1e-9)
+	assert.True(t, n == 3)
+	cutoff, _, n = RecommendReadScoreCutoff(scores, "c", 90)
+	assert.True(t, math.IsNaN(cutoff) && n == 0)
+}
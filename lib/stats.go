@@ -0,0 +1,275 @@
+package VClr
+
+import (
+	"math"
+	"sort"
+)
+
+// logChoose returns log(n choose k)
+func logChoose(n, k int) float64 {
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
+
+// hypergeometricLogProb is the log probability of the 2x2 table [[a, b], [c, d]] given its margins
+func hypergeometricLogProb(a, b, c, d int) float64 {
+	return logChoose(a+b, a) + logChoose(c+d, c) - logChoose(a+b+c+d, a+c)
+}
+
+// FisherExactTest returns the two-sided p-value for the 2x2 table [[a, b], [c, d]], summing the probabilities of
+// every table with the same margins that is no more likely than the observed one
+func FisherExactTest(a, b, c, d int) float64 {
+	if a < 0 || b < 0 || c < 0 || d < 0 {
+		panic("FisherExactTest: negative count")
+	}
+	row1 := a + b
+	col1 := a + c
+	n := a + b + c + d
+	if n == 0 {
+		return 1.0
+	}
+	observed := hypergeometricLogProb(a, b, c, d)
+	minA := 0
+	if col1-(n-row1) > 0 {
+		minA = col1 - (n - row1)
+	}
+	maxA := row1
+	if col1 < maxA {
+		maxA = col1
+	}
+	var p float64 = 0.0
+	for x := minA; x <= maxA; x++ {
+		lp := hypergeometricLogProb(x, row1-x, col1-x, n-row1-col1+x)
+		// allow for some floating point slop when comparing to the observed table
+		if lp <= observed+1e-7 {
+			p += math.Exp(lp)
+		}
+	}
+	if p > 1.0 {
+		return 1.0
+	}
+	return p
+}
+
+// BenjaminiHochberg returns the false discovery rate adjusted q-values for pValues, in the same order
+func BenjaminiHochberg(pValues []float64) []float64 {
+	n := len(pValues)
+	qValues := make([]float64, n)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return pValues[order[i]] < pValues[order[j]] })
+	runningMin := 1.0
+	for rank := n; rank >= 1; rank-- {
+		i := order[rank-1]
+		q := pValues[i] * float64(n) / float64(rank)
+		if q < runningMin {
+			runningMin = q
+		}
+		qValues[i] = runningMin
+	}
+	return qValues
+}
+
+// zScore is the standard normal quantile for a two-sided 1 - alpha interval
+func zScore(alpha float64) float64 {
+	return math.Sqrt2 * math.Erfinv(1-alpha)
+}
+
+func meanFloat(values []float64) float64 {
+	var total float64 = 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// stdDevFloat is the sample standard deviation
+func stdDevFloat(values []float64) float64 {
+	mean := meanFloat(values)
+	var ss float64 = 0.0
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(ss / float64(len(values)-1))
+}
+
+// betaContinuedFraction evaluates the continued fraction for the incomplete beta function (modified Lentz's method)
+func betaContinuedFraction(a, b, x float64) float64 {
+	const maxIterations = 300
+	const eps = 3e-14
+	const tiny = 1e-300
+	qab := a + b
+	qap := a + 1
+	qam := a - 1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		m2 := 2 * fm
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
+
+// regularizedIncompleteBeta is I_x(a, b), the CDF of the Beta(a, b) distribution at x
+func regularizedIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaQuantile inverts regularizedIncompleteBeta by bisection
+func betaQuantile(p, a, b float64) float64 {
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if regularizedIncompleteBeta(a, b, mid) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// WilsonInterval is the Wilson score 1 - alpha interval for a binomial proportion, NaN when n is 0
+func WilsonInterval(successes, n int, alpha float64) (float64, float64) {
+	if n == 0 {
+		return math.NaN(), math.NaN()
+	}
+	z := zScore(alpha)
+	nf := float64(n)
+	p := float64(successes) / nf
+	denominator := 1 + z*z/nf
+	center := (p + z*z/(2*nf)) / denominator
+	halfWidth := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf)) / denominator
+	return math.Max(0, center-halfWidth), math.Min(1, center+halfWidth)
+}
+
+// ClopperPearsonInterval is the exact 1 - alpha interval for a binomial proportion, NaN when n is 0
+func ClopperPearsonInterval(successes, n int, alpha float64) (float64, float64) {
+	if n == 0 {
+		return math.NaN(), math.NaN()
+	}
+	lo, hi := 0.0, 1.0
+	if successes > 0 {
+		lo = betaQuantile(alpha/2, float64(successes), float64(n-successes+1))
+	}
+	if successes < n {
+		hi = betaQuantile(1-alpha/2, float64(successes+1), float64(n-successes))
+	}
+	return lo, hi
+}
+
+// percentile of already sorted values, by linear interpolation
+func percentile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	pos := q * float64(len(sorted)-1)
+	i := int(math.Floor(pos))
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(i)
+	return sorted[i]*(1-frac) + sorted[i+1]*frac
+}
+
+// LinearFit is an ordinary least squares line, y = Slope * x + Intercept
+type LinearFit struct {
+	Slope     float64
+	Intercept float64
+	RSquared  float64
+	N         int
+}
+
+func (self *LinearFit) Predict(x float64) float64 {
+	return self.Slope*x + self.Intercept
+}
+
+// FitLine fits ys on xs, skipping pairs where either is NaN. The parameters are NaN with fewer than 2 points or when
+// all the xs are the same, and RSquared is NaN when all the ys are the same
+func FitLine(xs, ys []float64) *LinearFit {
+	if len(xs) != len(ys) {
+		panic("FitLine: xs and ys are different lengths")
+	}
+	var sx, sy float64
+	n := 0
+	for i := range xs {
+		if math.IsNaN(xs[i]) || math.IsNaN(ys[i]) {
+			continue
+		}
+		sx += xs[i]
+		sy += ys[i]
+		n += 1
+	}
+	fit := &LinearFit{Slope: math.NaN(), Intercept: math.NaN(), RSquared: math.NaN(), N: n}
+	if n < 2 {
+		return fit
+	}
+	meanX := sx / float64(n)
+	meanY := sy / float64(n)
+	var sxx, sxy, syy float64
+	for i := range xs {
+		if math.IsNaN(xs[i]) || math.IsNaN(ys[i]) {
+			continue
+		}
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+		syy += (ys[i] - meanY) * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return fit
+	}
+	fit.Slope = sxy / sxx
+	fit.Intercept = meanY - fit.Slope*meanX
+	if syy > 0 {
+		fit.RSquared = sxy * sxy / (sxx * syy)
+	}
+	return fit
+}
@@ -0,0 +1,124 @@
+package VClr
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFisherExactTest(t *testing.T) {
+	// the tea tasting table
+	p := FisherExactTest(3, 1, 1, 3)
+	assert.InDelta(t, 0.4857, p, 1e-4)
+	p = FisherExactTest(10, 0, 0, 10)
+	assert.InDelta(t, 1.0825e-5, p, 1e-8)
+	assert.True(t, FisherExactTest(0, 0, 0, 0) == 1.0)
+	assert.True(t, FisherExactTest(5, 5, 5, 5) == 1.0)
+}
+
+func TestBenjaminiHochberg(t *testing.T) {
+	pValues := []float64{0.01, 0.04, 0.03, 0.20}
+	qValues := BenjaminiHochberg(pValues)
+	assert.InDelta(t, 0.04, qValues[0], 1e-9)
+	assert.InDelta(t, 0.0533, qValues[1], 1e-4)
+	assert.InDelta(t, 0.0533, qValues[2], 1e-4)
+	assert.InDelta(t, 0.20, qValues[3], 1e-9)
+}
+
+func TestWilsonInterval(t *testing.T) {
+	lo, hi := WilsonInterval(2, 2, 0.05)
+	assert.InDelta(t, 0.3424, lo, 1e-4)
+	assert.InDelta(t, 1.0, hi, 1e-9)
+	lo, _ = WilsonInterval(200, 200, 0.05)
+	assert.InDelta(t, 0.9812, lo, 1e-4)
+	lo, _ = WilsonInterval(0, 0, 0.05)
+	assert.True(t, math.IsNaN(lo))
+}
+
+func TestClopperPearsonInterval(t *testing.T) {
+	lo, hi := ClopperPearsonInterval(2, 2, 0.05)
+	assert.InDelta(t, 0.1581, lo, 1e-4)
+	assert.InDelta(t, 1.0, hi, 1e-9)
+	lo, hi = ClopperPearsonInterval(5, 10, 0.05)
+	assert.InDelta(t, 0.1871, lo, 1e-4)
+	assert.InDelta(t, 0.8129, hi, 1e-4)
+}
+
+func TestSiteCallStats_BootstrapInterval(t *testing.T) {
+	stats := SiteCallStatsConstruct()
+	for i := 0; i < 50; i++ {
+		stats.AddCall("I")
+		stats.AddCall("A")
+	}
+	lo, hi := stats.BootstrapInterval(1000, 0.05, rand.New(rand.NewSource(1)))
+	assert.True(t, lo > 35 && lo < 45, "lo %v", lo)
+	assert.True(t, hi > 55 && hi < 65, "hi %v", hi)
+	assert.True(t, math.IsNaN(SiteCallStatsConstruct().PercentMethylatedCalls()))
+}
+
+func TestSiteCallStats_IntervalsIgnoreNoCalls(t *testing.T) {
+	confident := "ref\t5\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t5\tI\t0.8\tt\tforward\tr2\n"
+	// r3 and r4 are below the threshold
+	withNoCalls := confident +
+		"ref\t5\tI\t0.3\tt\tforward\tr3\n" +
+		"ref\t5\tA\t0.4\tt\tforward\tr4\n"
+	threshold := ThresholdPolicyConstruct(0.5)
+	a := SiteMethylationStats(alignmentFromString(confident), threshold)
+	b := SiteMethylationStats(alignmentFromString(withNoCalls), threshold)
+	assert.True(t, b.NumberOfCalls() == 2)
+	assert.InDelta(t, 100.0, b.PercentMethylatedCalls(), 1e-9)
+
+	aLo, aHi := a.WilsonInterval(0.05)
+	bLo, bHi := b.WilsonInterval(0.05)
+	assert.InDelta(t, 34.24, bLo, 1e-2)
+	assert.InDelta(t, aLo, bLo, 1e-9)
+	assert.InDelta(t, aHi, bHi, 1e-9)
+	aLo, aHi = a.ClopperPearsonInterval(0.05)
+	bLo, bHi = b.ClopperPearsonInterval(0.05)
+	assert.InDelta(t, aLo, bLo, 1e-9)
+	assert.InDelta(t, aHi, bHi, 1e-9)
+	aLo, aHi = a.BootstrapInterval(200, 0.05, rand.New(rand.NewSource(1)))
+	bLo, bHi = b.BootstrapInterval(200, 0.05, rand.New(rand.NewSource(1)))
+	assert.InDelta(t, aLo, bLo, 1e-9)
+	assert.InDelta(t, aHi, bHi, 1e-9)
+}
+
+func TestProbEntropy(t *testing.T) {
+	vca := alignmentFromString(
+		"ref\t10\tA\t0.6\tt\tforward\tr1\n" +
+		"ref\t10\tA\t0.6\tc\tbackward\tr2\n" +
+		"ref\t10\tA\t0.4\tc\tforward\tr3\n" +
+		"ref\t10\tG\t0.4\tt\tforward\tr4\n")
+	probs := vca.SiteProbsOnCodingStrand(ThresholdPolicyConstruct(0.0))
+	call, prob := argmaxProb(probs)
+	assert.True(t, call == "A")
+	assert.InDelta(t, 0.6, prob, 1e-9)
+	second, secondProb := SecondBestProb(probs, call)
+	// G and T are tied, ties go to the first base alphabetically
+	assert.True(t, second == "G")
+	assert.InDelta(t, 0.2, secondProb, 1e-9)
+	assert.InDelta(t, -0.6*math.Log2(0.6)-0.4*math.Log2(0.2), ProbEntropy(probs), 1e-9)
+
+	assert.InDelta(t, 0.0, ProbEntropy(map[string]float64{"I": 1.0}), 1e-12)
+	assert.InDelta(t, 2.0, ProbEntropy(map[string]float64{"A": 0.25, "C": 0.25, "G": 0.25, "T": 0.25}), 1e-12)
+	assert.True(t, math.IsNaN(ProbEntropy(map[string]float64{})))
+	second, secondProb = SecondBestProb(map[string]float64{"I": 1.0}, "I")
+	assert.True(t, second == "" && secondProb == 0)
+}
+
+func TestFitLine(t *testing.T) {
+	fit := FitLine([]float64{0, 1, 2, math.NaN()}, []float64{1, 3, 5, 100})
+	assert.True(t, fit.N == 3)
+	assert.InDelta(t, 2.0, fit.Slope, 1e-12)
+	assert.InDelta(t, 1.0, fit.Intercept, 1e-12)
+	assert.InDelta(t, 1.0, fit.RSquared, 1e-12)
+	assert.InDelta(t, 7.0, fit.Predict(3), 1e-12)
+
+	fit = FitLine([]float64{0, 1, 2, 3}, []float64{0, 2, 1, 3})
+	assert.InDelta(t, 0.8, fit.Slope, 1e-12)
+	assert.InDelta(t, 0.64, fit.RSquared, 1e-12)
+	assert.True(t, math.IsNaN(FitLine([]float64{1, 1}, []float64{0, 2}).Slope))
+	assert.True(t, math.IsNaN(FitLine([]float64{1}, []float64{2}).Slope))
+}
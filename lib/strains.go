@@ -0,0 +1,236 @@
+package VClr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Unassigned is the strain for reads with too few informative sites or a tie between strains
+const Unassigned = "unassigned"
+
+// StrainProfile has the strain-defining sites, Sites maps a 0-based reference position to the base for each strain
+type StrainProfile struct {
+	Strains []string
+	Sites   map[int]map[string]string
+}
+
+func StrainProfileConstruct() *StrainProfile {
+	return &StrainProfile{Strains: make([]string, 0), Sites: make(map[int]map[string]string)}
+}
+
+func (self *StrainProfile) add(site int, strain, base string) {
+	_, check := self.Sites[site]
+	if !check {
+		self.Sites[site] = make(map[string]string)
+	}
+	_, seen := self.Sites[site][strain]
+	if seen {
+		err := fmt.Sprintf("StrainProfile: strain %v has more than one base at site %v", strain, site)
+		panic(err)
+	}
+	self.Sites[site][strain] = base
+	for _, s := range self.Strains {
+		if s == strain {
+			return
+		}
+	}
+	self.Strains = append(self.Strains, strain)
+}
+
+// dropUninformative removes sites where every strain has the same base
+func (self *StrainProfile) dropUninformative() {
+	for site, bases := range self.Sites {
+		distinct := make(map[string]bool)
+		for _, b := range bases {
+			distinct[b] = true
+		}
+		if len(distinct) < 2 {
+			delete(self.Sites, site)
+		}
+	}
+}
+
+// genotypeAllele is the first allele index of a GT field, -1 when it is missing
+func genotypeAllele(gt string) int {
+	first := strings.FieldsFunc(gt, func(r rune) bool { return r == '/' || r == '|' })
+	if len(first) == 0 {
+		return -1
+	}
+	i, err := strconv.Atoi(first[0])
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// StrainProfileFromVcf uses each sample of a VCF as a strain, the base is the first allele of the sample's genotype.
+// Only SNVs are used and samples with a missing genotype are left out at that site. Multi-allelic sites split over
+// several records (as bcftools norm -m- writes them) are merged, a sample that has the REF allele in one record and
+// an ALT in another gets the ALT. Two different ALTs for the same sample and site are an error
+func StrainProfileFromVcf(samples []string, records []*VcfRecord) (*StrainProfile, error) {
+	profile := StrainProfileConstruct()
+	for _, s := range samples {
+		profile.Strains = append(profile.Strains, s)
+	}
+	for _, r := range records {
+		if !r.IsSnv() {
+			continue
+		}
+		for i, gt := range r.Genotypes {
+			allele := genotypeAllele(gt)
+			if allele < 0 || allele > len(r.Alt) || i >= len(samples) {
+				continue
+			}
+			base := r.Ref
+			if allele > 0 {
+				base = r.Alt[allele-1]
+			}
+			existing, seen := profile.Sites[r.Pos][samples[i]]
+			if !seen {
+				profile.add(r.Pos, samples[i], base)
+				continue
+			}
+			if existing == base || base == r.Ref {
+				continue
+			}
+			if existing != r.Ref {
+				return nil, fmt.Errorf("StrainProfileFromVcf: strain %v has both %v and %v at %v:%v", samples[i],
+					existing, base, r.Chrom, r.Pos+1)
+			}
+			profile.Sites[r.Pos][samples[i]] = base
+		}
+	}
+	profile.dropUninformative()
+	return profile, nil
+}
+
+// ParseStrainTable reads a tab-separated table of site (0-based), strain and base, lines starting with # are
+// skipped
+func ParseStrainTable(file io.Reader) *StrainProfile {
+	profile := StrainProfileConstruct()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			err := fmt.Sprintf("ParseStrainTable: malformed line %v", line)
+			panic(err)
+		}
+		site, err := strconv.Atoi(fields[0])
+		if err != nil {
+			panic(fmt.Sprintf("ParseStrainTable: bad site %v", fields[0]))
+		}
+		profile.add(site, fields[1], strings.ToUpper(fields[2]))
+	}
+	if err := scanner.Err(); err != nil {
+		panic(fmt.Sprintf("ParseStrainTable: %v", err))
+	}
+	profile.dropUninformative()
+	return profile
+}
+
+// ReadStrainAssignment is the most likely strain for a read, Margin is the log-likelihood difference to the next
+// best strain
+type ReadStrainAssignment struct {
+	ReadLabel     string
+	Strain        string
+	NSites        int
+	LogLikelihood float64
+	Margin        float64
+}
+
+// StrainMixture has the assignment of each read
+type StrainMixture struct {
+	Strains []string
+	Reads   []*ReadStrainAssignment
+}
+
+// Counts is the number of reads assigned to each strain, including Unassigned
+func (self *StrainMixture) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, s := range self.Strains {
+		counts[s] = 0
+	}
+	counts[Unassigned] = 0
+	for _, r := range self.Reads {
+		counts[r.Strain] += 1
+	}
+	return counts
+}
+
+// NumberAssigned is the number of reads assigned to a strain
+func (self *StrainMixture) NumberAssigned() int {
+	return len(self.Reads) - self.Counts()[Unassigned]
+}
+
+// Proportion is the fraction of the assigned reads that belong to strain with its Wilson score 1 - alpha interval
+func (self *StrainMixture) Proportion(strain string, alpha float64) (float64, float64, float64) {
+	n := self.NumberAssigned()
+	k := self.Counts()[strain]
+	lo, hi := WilsonInterval(k, n, alpha)
+	return float64(k) / float64(n), lo, hi
+}
+
+// AssignReadsToStrains scores each read against every strain with the sum over the strain-defining sites of
+// log(P(strain's base)), using the read's probabilities from SiteProbsOnCodingStrand and 0.25 where the strain has
+// no base. Reads with fewer than minSites sites with a call, or with more than one best strain, are Unassigned
+func AssignReadsToStrains(alignment *VcAlignment, profile *StrainProfile, threshold *ThresholdPolicy,
+	minSites int) *StrainMixture {
+	reads := make([]*ReadStrainAssignment, 0)
+	for readLabel, readAln := range alignment.GroupByRead() {
+		logLikelihoods := make(map[string]float64)
+		nSites := 0
+		for site, siteAln := range readAln.GroupBySite() {
+			bases, isStrainSite := profile.Sites[site]
+			if !isStrainSite {
+				continue
+			}
+			probs := siteAln.SiteProbsOnCodingStrand(threshold)
+			if len(probs) == 0 {
+				continue
+			}
+			nSites += 1
+			for _, strain := range profile.Strains {
+				base, check := bases[strain]
+				if !check {
+					// no genotype for this strain, any base is as likely
+					logLikelihoods[strain] += math.Log(0.25)
+					continue
+				}
+				logLikelihoods[strain] += math.Log(probs[base] + llrPseudocount)
+			}
+		}
+		assignment := &ReadStrainAssignment{ReadLabel: readLabel, Strain: Unassigned, NSites: nSites,
+			LogLikelihood: math.NaN(), Margin: math.NaN()}
+		if nSites >= minSites && nSites > 0 {
+			best := math.Inf(-1)
+			second := math.Inf(-1)
+			for _, strain := range profile.Strains {
+				ll := logLikelihoods[strain]
+				if ll > best {
+					second = best
+					best = ll
+					assignment.Strain = strain
+				} else if ll > second {
+					second = ll
+				}
+			}
+			assignment.LogLikelihood = best
+			assignment.Margin = best - second
+			if best == second {
+				assignment.Strain = Unassigned
+			}
+		}
+		reads = append(reads, assignment)
+	}
+	sort.Slice(reads, func(i, j int) bool { return reads[i].ReadLabel < reads[j].ReadLabel })
+	return &StrainMixture{Strains: profile.Strains, Reads: reads}
+}
@@ -0,0 +1,79 @@
+package VClr
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrainProfiles(t *testing.T) {
+	vcf := "##fileformat=VCFv4.2\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tA\tB\n" +
+		"ref\t11\t.\tC\tT\t.\tPASS\t.\tGT\t0\t1\n" +
+		"ref\t21\t.\tG\tA,C\t.\tPASS\t.\tGT\t2/2\t1|1\n" +
+		"ref\t31\t.\tG\tA\t.\tPASS\t.\tGT\t1\t1\n" +
+		"ref\t41\t.\tGA\tG\t.\tPASS\t.\tGT\t0\t1\n"
+	samples, records := ParseVcf(strings.NewReader(vcf))
+	profile, err := StrainProfileFromVcf(samples, records)
+	assert.True(t, err == nil)
+	assert.Equal(t, []string{"A", "B"}, profile.Strains)
+	// site 30 doesn't distinguish the strains and site 40 isn't a SNV
+	assert.True(t, len(profile.Sites) == 2)
+	assert.Equal(t, map[string]string{"A": "C", "B": "T"}, profile.Sites[10])
+	assert.Equal(t, map[string]string{"A": "C", "B": "A"}, profile.Sites[20])
+
+	table := ParseStrainTable(strings.NewReader("# site\tstrain\tbase\n10\tA\tc\n10\tB\tT\n20\tA\tC\n20\tB\tA\n"))
+	assert.Equal(t, profile.Sites, table.Sites)
+}
+
+func TestStrainProfileFromSplitVcf(t *testing.T) {
+	// G>A,C at 21 split into two records
+	header := "##fileformat=VCFv4.2\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tA\tB\tC\n"
+	vcf := header +
+		"ref\t21\t.\tG\tA\t.\tPASS\t.\tGT\t0\t1\t0\n" +
+		"ref\t21\t.\tG\tC\t.\tPASS\t.\tGT\t0\t0\t1\n"
+	samples, records := ParseVcf(strings.NewReader(vcf))
+	profile, err := StrainProfileFromVcf(samples, records)
+	assert.True(t, err == nil)
+	assert.Equal(t, map[string]string{"A": "G", "B": "A", "C": "C"}, profile.Sites[20])
+
+	// B can't be both A and C
+	vcf = header +
+		"ref\t21\t.\tG\tA\t.\tPASS\t.\tGT\t0\t1\t0\n" +
+		"ref\t21\t.\tG\tC\t.\tPASS\t.\tGT\t0\t1\t1\n"
+	samples, records = ParseVcf(strings.NewReader(vcf))
+	profile, err = StrainProfileFromVcf(samples, records)
+	assert.True(t, err != nil && profile == nil)
+}
+
+func TestAssignReadsToStrains(t *testing.T) {
+	profile := ParseStrainTable(strings.NewReader("10\tA\tC\n10\tB\tT\n20\tA\tC\n20\tB\tA\n"))
+	table := ""
+	for _, r := range []string{"a1", "a2", "a3"} {
+		table += "ref\t10\tC\t0.9\tt\tforward\t" + r + "\n" +
+			"ref\t20\tC\t0.8\tt\tforward\t" + r + "\n"
+	}
+	// complement strand reads in the forward orientation are reverse complemented
+	table += "ref\t10\tA\t0.9\tc\tforward\tb1\n" +
+		"ref\t20\tT\t0.9\tc\tforward\tb1\n" +
+		"ref\t10\tT\t0.9\tt\tforward\tu1\n" +
+		"ref\t30\tT\t0.9\tt\tforward\tu2\n"
+	vca := alignmentFromString(table)
+
+	mixture := AssignReadsToStrains(vca, profile, ThresholdPolicyConstruct(0.0), 2)
+	assert.True(t, len(mixture.Reads) == 6)
+	counts := mixture.Counts()
+	assert.Equal(t, map[string]int{"A": 3, "B": 1, Unassigned: 2}, counts)
+	assert.True(t, mixture.NumberAssigned() == 4)
+	p, lo, hi := mixture.Proportion("A", 0.05)
+	assert.InDelta(t, 0.75, p, 1e-9)
+	assert.True(t, lo < p && p < hi)
+	assert.True(t, mixture.Reads[0].ReadLabel == "a1" && mixture.Reads[0].NSites == 2)
+	assert.InDelta(t, 2*math.Log(1+llrPseudocount)-2*math.Log(llrPseudocount), mixture.Reads[0].Margin, 1e-6)
+	assert.True(t, mixture.Reads[4].ReadLabel == "u1" && mixture.Reads[4].NSites == 1)
+
+	mixture = AssignReadsToStrains(vca, profile, ThresholdPolicyConstruct(0.0), 1)
+	assert.True(t, mixture.Counts()["B"] == 2)
+}
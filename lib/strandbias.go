@@ -0,0 +1,71 @@
+package VClr
+
+// OrientationLabels are the strand and orientation combinations in the order they are reported
+var OrientationLabels = []string{"t-forward", "t-backward", "c-forward", "c-backward"}
+
+// StrandBias splits the reads at a site by strand and orientation (keyed like orientationLabel), counting the reads
+// with a call and the ones whose call agrees with the site call. The genomic strand counts put t-forward and
+// c-backward reads on the same strand as the reference (see onCodingStrand)
+type StrandBias struct {
+	Call       string
+	Reads      map[string]int
+	Supporting map[string]int
+	genomic    [2][2]int
+}
+
+func StrandBiasConstruct(call string) *StrandBias {
+	reads := make(map[string]int)
+	supporting := make(map[string]int)
+	for _, label := range OrientationLabels {
+		reads[label] = 0
+		supporting[label] = 0
+	}
+	return &StrandBias{Call: call, Reads: reads, Supporting: supporting}
+}
+
+// AddRead counts a read's call, reads without a call ("") are skipped
+func (self *StrandBias) AddRead(strand string, forward bool, readCall string) {
+	if readCall == "" {
+		return
+	}
+	label := orientationLabel(strand, forward)
+	self.Reads[label] += 1
+	row := 1
+	if onCodingStrand(strand, forward) {
+		row = 0
+	}
+	if readCall == self.Call {
+		self.Supporting[label] += 1
+		self.genomic[row][0] += 1
+	} else {
+		self.genomic[row][1] += 1
+	}
+}
+
+// CallFraction is the fraction of the reads with the strand and orientation in label that agree with the site
+// call, NaN when there aren't any
+func (self *StrandBias) CallFraction(label string) float64 {
+	return float64(self.Supporting[label]) / float64(self.Reads[label])
+}
+
+// PValue is Fisher's exact test of the reads agreeing and disagreeing with the site call on the two genomic strands
+func (self *StrandBias) PValue() float64 {
+	return FisherExactTest(self.genomic[0][0], self.genomic[0][1], self.genomic[1][0], self.genomic[1][1])
+}
+
+// SiteStrandBias calls each read at a site separately for each strand and orientation and compares them to call.
+// When coding is true reads are called with CallSiteOnCodingStrand as in CallSite, otherwise with CallSiteOnStrand
+// as in CallSiteMethylation
+func SiteStrandBias(siteSorted *VcAlignment, call string, threshold *ThresholdPolicy, coding bool) *StrandBias {
+	bias := StrandBiasConstruct(call)
+	forEachOrientedRead(siteSorted, func(strand string, forward bool, aln *VcAlignment) {
+		var readCall string
+		if coding {
+			readCall, _ = aln.CallSiteOnCodingStrand(threshold)
+		} else {
+			readCall, _ = aln.CallSiteOnStrand(threshold)
+		}
+		bias.AddRead(strand, forward, readCall)
+	})
+	return bias
+}
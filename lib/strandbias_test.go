@@ -0,0 +1,38 @@
+package VClr
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteStrandBias(t *testing.T) {
+	table := ""
+	for _, r := range []string{"r1", "r2", "r3", "r4"} {
+		table += "ref\t10\tA\t0.9\tt\tforward\t" + r + "\n"
+	}
+	// the alternate base is only seen on complement reads in the forward orientation
+	for _, r := range []string{"r5", "r6", "r7", "r8", "r9", "r12"} {
+		table += "ref\t10\tA\t0.9\tc\tforward\t" + r + "\n"
+	}
+	table += "ref\t10\tA\t0.9\tc\tbackward\tr10\n" +
+		"ref\t10\tA\t0.2\tc\tbackward\tr11\n"
+	vca := alignmentFromString(table)
+	call, _, _ := CallSite(vca, ThresholdPolicyConstruct(0.0))
+	assert.Equal(t, "T", call)
+
+	bias := SiteStrandBias(vca, call, ThresholdPolicyConstruct(0.5), true)
+	assert.True(t, bias.Reads["t-forward"] == 4 && bias.Supporting["t-forward"] == 0)
+	assert.True(t, bias.Reads["c-forward"] == 6 && bias.Supporting["c-forward"] == 6)
+	// r11 is below the threshold
+	assert.True(t, bias.Reads["c-backward"] == 1 && bias.Reads["t-backward"] == 0)
+	assert.InDelta(t, 1.0, bias.CallFraction("c-forward"), 1e-9)
+	assert.True(t, math.IsNaN(bias.CallFraction("t-backward")))
+	assert.InDelta(t, FisherExactTest(0, 5, 6, 0), bias.PValue(), 1e-12)
+	assert.True(t, bias.PValue() < 0.01)
+
+	// without the strand correction every read calls A
+	bias = SiteStrandBias(vca, "A", ThresholdPolicyConstruct(0.5), false)
+	assert.True(t, bias.Supporting["c-forward"] == 6 && bias.Supporting["t-forward"] == 4)
+	assert.InDelta(t, 1.0, bias.PValue(), 1e-9)
+}
@@ -0,0 +1,86 @@
+package VClr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Wildcard matches any strand or base in a ThresholdPolicy
+const Wildcard = "*"
+
+// ThresholdPolicy is the minimum probability an aligned pair needs to be used when calling, it can be set for a
+// strand (t or c), a base symbol as it appears in the alignment (before any strand correction) or both. The most
+// specific match wins: strand and base, then base, then strand, then Default
+type ThresholdPolicy struct {
+	Default    float64
+	thresholds map[string]float64
+}
+
+// ThresholdPolicyConstruct makes a policy that uses defaultThreshold for every aligned pair
+func ThresholdPolicyConstruct(defaultThreshold float64) *ThresholdPolicy {
+	return &ThresholdPolicy{Default: defaultThreshold, thresholds: make(map[string]float64)}
+}
+
+func thresholdKey(strand, base string) string {
+	return strand + "\t" + base
+}
+
+// Set the threshold for strand and base, either can be the Wildcard and setting both to it changes the Default
+func (self *ThresholdPolicy) Set(strand, base string, threshold float64) {
+	if strand != Wildcard && strand != "t" && strand != "c" {
+		err := fmt.Sprintf("ThresholdPolicy: strand must be t, c or %v, got %v", Wildcard, strand)
+		panic(err)
+	}
+	if strand == Wildcard && base == Wildcard {
+		self.Default = threshold
+		return
+	}
+	self.thresholds[thresholdKey(strand, base)] = threshold
+}
+
+// Threshold is the threshold for an aligned pair on strand with base
+func (self *ThresholdPolicy) Threshold(strand, base string) float64 {
+	for _, key := range []string{thresholdKey(strand, base), thresholdKey(Wildcard, base),
+		thresholdKey(strand, Wildcard)} {
+		t, check := self.thresholds[key]
+		if check {
+			return t
+		}
+	}
+	return self.Default
+}
+
+// Passes is true when the aligned pair's probability is at or above its threshold
+func (self *ThresholdPolicy) Passes(r *AlnRecord) bool {
+	return r.prob >= self.Threshold(r.strand, r.base)
+}
+
+// ParseThresholdPolicy reads a tab-separated table of strand, base and threshold on top of defaultThreshold, for
+// example "c\t*\t0.6" or "*\tI\t0.4". Lines starting with # are skipped
+func ParseThresholdPolicy(file io.Reader, defaultThreshold float64) *ThresholdPolicy {
+	policy := ThresholdPolicyConstruct(defaultThreshold)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			err := fmt.Sprintf("ParseThresholdPolicy: malformed line %v", line)
+			panic(err)
+		}
+		threshold, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			panic(fmt.Sprintf("ParseThresholdPolicy: bad threshold %v", fields[2]))
+		}
+		policy.Set(fields[0], fields[1], threshold)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(fmt.Sprintf("ParseThresholdPolicy: %v", err))
+	}
+	return policy
+}
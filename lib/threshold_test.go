@@ -0,0 +1,35 @@
+package VClr
+
+import (
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdPolicy(t *testing.T) {
+	policy := ParseThresholdPolicy(strings.NewReader(
+		"# strand\tbase\tthreshold\n" +
+		"c\t*\t0.6\n" +
+		"*\tI\t0.3\n" +
+		"c\tI\t0.5\n"), 0.4)
+	assert.InDelta(t, 0.4, policy.Threshold("t", "A"), 1e-12)
+	assert.InDelta(t, 0.6, policy.Threshold("c", "A"), 1e-12)
+	assert.InDelta(t, 0.3, policy.Threshold("t", "I"), 1e-12)
+	assert.InDelta(t, 0.5, policy.Threshold("c", "I"), 1e-12)
+
+	vca := alignmentFromString(
+		"ref\t10\tA\t0.5\tc\tforward\tr1\n" +
+		"ref\t10\tI\t0.55\tc\tforward\tr2\n" +
+		"ref\t10\tI\t0.35\tt\tforward\tr3\n" +
+		"ref\t10\tA\t0.2\tt\tforward\tr4\n")
+	// only r2 and r3 pass their thresholds
+	probs := vca.SiteProbsOnStrand(policy)
+	assert.Equal(t, 1, len(probs))
+	assert.InDelta(t, 1.0, probs["I"], 1e-9)
+	probs = vca.SiteProbsOnStrand(ThresholdPolicyConstruct(0.0))
+	assert.InDelta(t, 0.7/1.6, probs["A"], 1e-9)
+
+	policy.Set(Wildcard, Wildcard, 0.1)
+	assert.InDelta(t, 0.1, policy.Threshold("t", "A"), 1e-12)
+	assert.Panics(t, func() { policy.Set("x", "A", 0.5) })
+}
@@ -0,0 +1,96 @@
+package VClr
+
+import (
+	"math"
+	"sort"
+)
+
+// TitrationSample is the site calls for one mixture of methylated and unmethylated DNA, Expected is the percent
+// methylated DNA in the mixture
+type TitrationSample struct {
+	Label    string
+	Expected float64
+	Sites    map[int]*SiteCallStats
+}
+
+// SiteTitration has the observed percent methylated at a site in each sample and its residual from the standard
+// curve, both NaN for samples with too few calls at the site
+type SiteTitration struct {
+	Site            int
+	Observed        []float64
+	Residuals       []float64
+	MeanAbsResidual float64
+}
+
+// TitrationResult has a standard curve fit to the percent methylated pooled over every site in each sample, and
+// one fit to each site in each sample
+type TitrationResult struct {
+	Samples   []*TitrationSample
+	Pooled    []float64
+	PooledFit *LinearFit
+	SiteFit   *LinearFit
+	Sites     []*SiteTitration
+}
+
+// Titration fits observed against expected percent methylated, samples are sorted by their expected percent. A
+// site needs minCalls calls in a sample to be used for it, and to be in at least two samples to be reported
+func Titration(samples []*TitrationSample, minCalls int) *TitrationResult {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Expected < samples[j].Expected })
+	result := &TitrationResult{Samples: samples, Pooled: make([]float64, len(samples)),
+		Sites: make([]*SiteTitration, 0)}
+	expected := make([]float64, len(samples))
+	bySite := make(map[int]*SiteTitration)
+	for i, sample := range samples {
+		expected[i] = sample.Expected
+		pooled := SiteCallStatsConstruct()
+		for site, stats := range sample.Sites {
+			pooled.Merge(stats)
+			if stats.NumberOfCalls() < minCalls || stats.NumberOfCalls() == 0 {
+				continue
+			}
+			_, check := bySite[site]
+			if !check {
+				bySite[site] = &SiteTitration{Site: site, Observed: make([]float64, len(samples)),
+					Residuals: make([]float64, len(samples))}
+				for j := range samples {
+					bySite[site].Observed[j] = math.NaN()
+				}
+			}
+			bySite[site].Observed[i] = stats.PercentMethylatedCalls()
+		}
+		result.Pooled[i] = pooled.PercentMethylatedCalls()
+	}
+	result.PooledFit = FitLine(expected, result.Pooled)
+
+	siteXs := make([]float64, 0)
+	siteYs := make([]float64, 0)
+	for _, st := range bySite {
+		nObserved := 0
+		for _, obs := range st.Observed {
+			if !math.IsNaN(obs) {
+				nObserved += 1
+			}
+		}
+		if nObserved < 2 {
+			continue
+		}
+		siteXs = append(siteXs, expected...)
+		siteYs = append(siteYs, st.Observed...)
+		result.Sites = append(result.Sites, st)
+	}
+	sort.Slice(result.Sites, func(i, j int) bool { return result.Sites[i].Site < result.Sites[j].Site })
+	result.SiteFit = FitLine(siteXs, siteYs)
+	for _, st := range result.Sites {
+		var total float64 = 0.0
+		n := 0
+		for i, obs := range st.Observed {
+			st.Residuals[i] = obs - result.SiteFit.Predict(expected[i])
+			if !math.IsNaN(st.Residuals[i]) {
+				total += math.Abs(st.Residuals[i])
+				n += 1
+			}
+		}
+		st.MeanAbsResidual = total / float64(n)
+	}
+	return result
+}
@@ -0,0 +1,49 @@
+package VClr
+
+import (
+	"math"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// titrationSample makes site calls with nMethyl of 4 calls methylated at each site
+func titrationSample(label string, expected float64, nMethyl map[int]int) *TitrationSample {
+	sites := make(map[int]*SiteCallStats)
+	for site, m := range nMethyl {
+		sites[site] = SiteCallStatsConstruct()
+		for i := 0; i < 4; i++ {
+			if i < m {
+				sites[site].AddCall("I")
+			} else {
+				sites[site].AddCall("A")
+			}
+		}
+	}
+	return &TitrationSample{Label: label, Expected: expected, Sites: sites}
+}
+
+func TestTitration(t *testing.T) {
+	samples := []*TitrationSample{
+		titrationSample("full", 100, map[int]int{10: 4, 20: 4, 30: 4}),
+		titrationSample("none", 0, map[int]int{10: 0, 20: 0, 30: 2}),
+		titrationSample("half", 50, map[int]int{10: 2, 20: 2}),
+	}
+	result := Titration(samples, 1)
+	assert.True(t, result.Samples[0].Label == "none" && result.Samples[2].Label == "full")
+	assert.InDelta(t, 100.0/6.0, result.Pooled[0], 1e-9)
+	assert.InDelta(t, 100.0, result.Pooled[2], 1e-9)
+	assert.True(t, result.PooledFit.N == 3)
+
+	assert.True(t, len(result.Sites) == 3)
+	assert.True(t, result.SiteFit.N == 8)
+	site30 := result.Sites[2]
+	assert.True(t, site30.Site == 30 && math.IsNaN(site30.Observed[1]) && math.IsNaN(site30.Residuals[1]))
+	assert.InDelta(t, 50.0-result.SiteFit.Predict(0), site30.Residuals[0], 1e-9)
+	// site 30 is furthest from the curve
+	assert.True(t, site30.MeanAbsResidual > result.Sites[0].MeanAbsResidual)
+
+	// with 5 calls needed nothing is left
+	result = Titration(samples, 5)
+	assert.True(t, len(result.Sites) == 0 && result.SiteFit.N == 0)
+	assert.InDelta(t, 100.0/6.0, result.Pooled[0], 1e-9)
+}
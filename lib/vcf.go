@@ -0,0 +1,124 @@
+package VClr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// VcfRecord is one line of a VCF file, Pos is converted to the 0-based reference coordinates used by the alignments
+// and Genotypes holds the GT field for each sample
+type VcfRecord struct {
+	Chrom     string
+	Pos       int
+	Id        string
+	Ref       string
+	Alt       []string
+	Genotypes []string
+}
+
+func (self VcfRecord) String() string {
+	return fmt.Sprintf("%v:%v %v>%v", self.Chrom, self.Pos, self.Ref, strings.Join(self.Alt, ","))
+}
+
+// IsSnv is true when the reference and all of the alternate alleles are single bases
+func (self *VcfRecord) IsSnv() bool {
+	if len(self.Ref) != 1 {
+		return false
+	}
+	for _, a := range self.Alt {
+		if len(a) != 1 || a == "." {
+			return false
+		}
+	}
+	return len(self.Alt) > 0
+}
+
+// genotypeField finds the GT field in a sample column using the FORMAT column
+func genotypeField(format, sample string) string {
+	keys := strings.Split(format, ":")
+	values := strings.Split(sample, ":")
+	for i, k := range keys {
+		if k == "GT" && i < len(values) {
+			return values[i]
+		}
+	}
+	return "."
+}
+
+// ParseVcf reads a VCF file, returning the sample names and the records
+func ParseVcf(file io.Reader) ([]string, []*VcfRecord) {
+	samples := make([]string, 0)
+	records := make([]*VcfRecord, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "##") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if strings.HasPrefix(line, "#CHROM") {
+			if len(fields) > 9 {
+				samples = append(samples, fields[9:]...)
+			}
+			continue
+		}
+		if len(fields) < 5 {
+			err := fmt.Sprintf("ParseVcf: malformed line %v", line)
+			panic(err)
+		}
+		pos, err := strconv.Atoi(fields[1])
+		if err != nil {
+			panic(fmt.Sprintf("ParseVcf: bad position %v", fields[1]))
+		}
+		rec := &VcfRecord{Chrom: fields[0], Pos: pos - 1, Id: fields[2], Ref: strings.ToUpper(fields[3]),
+			Alt: strings.Split(strings.ToUpper(fields[4]), ","), Genotypes: make([]string, 0)}
+		if len(fields) > 9 {
+			for _, sample := range fields[9:] {
+				rec.Genotypes = append(rec.Genotypes, genotypeField(fields[8], sample))
+			}
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(fmt.Sprintf("ParseVcf: %v", err))
+	}
+	return samples, records
+}
+
+// TruthSnvs makes a map of 0-based reference positions to the (first) alternate base for the SNVs in records,
+// other kinds of variants are ignored
+func TruthSnvs(records []*VcfRecord) map[int]string {
+	truth := make(map[int]string)
+	for _, r := range records {
+		if !r.IsSnv() {
+			continue
+		}
+		truth[r.Pos] = r.Alt[0]
+	}
+	return truth
+}
+
+// WritePhasedVcf writes the sites as a single sample VCF, sites in blocks with more than one site get a phased
+// genotype and a PS (phase set) tag with the 1-based position of the block's first site
+func WritePhasedVcf(w io.Writer, chrom, sample string, sites []*PhasedSite) {
+	fmt.Fprintf(w, "##fileformat=VCFv4.2\n")
+	fmt.Fprintf(w, "##contig=<ID=%v>\n", chrom)
+	fmt.Fprintf(w, "##INFO=<ID=DP,Number=1,Type=Integer,Description=\"Number of reads\">\n")
+	fmt.Fprintf(w, "##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n")
+	fmt.Fprintf(w, "##FORMAT=<ID=PS,Number=1,Type=Integer,Description=\"Phase set\">\n")
+	fmt.Fprintf(w, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t%v\n", sample)
+	for _, s := range sites {
+		format := "GT"
+		genotype := "0/1"
+		if s.BlockSize > 1 {
+			format = "GT:PS"
+			genotype = fmt.Sprintf("%v|%v:%v", s.Haplotype, 1-s.Haplotype, s.Block+1)
+		}
+		fmt.Fprintf(w, "%v\t%v\t.\t%v\t%v\t.\tPASS\tDP=%v\t%v\t%v\n", chrom, s.RefPos+1, s.Ref, s.Alt, s.Coverage,
+			format, genotype)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"strconv"
 	"math"
+	"math/rand"
 	"sort"
 	//"bufio"
 )
@@ -104,6 +105,19 @@ func (self *VcAlignment) GroupByStrand() map[string]*VcAlignment {
 	return grouped
 }
 
+// GroupByForward splits the alignment into reads that aligned forward (true) and backward (false)
+func (self *VcAlignment) GroupByForward() map[bool]*VcAlignment {
+	grouped := make(map[bool]*VcAlignment)
+	for _, r := range self.Records {
+		_, contains := grouped[r.forward]
+		if !contains {
+			grouped[r.forward] = VcAlignmentConstruct()
+		}
+		grouped[r.forward].AddRecord(r)
+	}
+	return grouped
+}
+
 func (self *VcAlignment) FilterByReadScore(threshold float64) *VcAlignment {
 	filtered := VcAlignmentConstruct()
 	byRead := self.GroupByRead()
@@ -190,20 +204,18 @@ func checkProbs(probs map[string]float64, allowedDiff float64) bool {
 	}
 }
 
-// CallSiteOnStrand does not correct for forward/backward template/complement, it just calls the base with the argmax
-// probability
-func (self *VcAlignment) CallSiteOnStrand(threshold float64) (string, float64) {
+// SiteProbsOnStrand marginalizes over the aligned pairs at a site (that pass the threshold policy) and returns the
+// normalized probability of each base, it does not correct for forward/backward template/complement. An empty map
+// means the site can't be called
+func (self *VcAlignment) SiteProbsOnStrand(threshold *ThresholdPolicy) map[string]float64 {
 	site := self.Records[0].refPos
 	probs := make(map[string]float64)
-	call := ""
-	maxProb := math.Inf(-1)
 	for _, r := range self.Records {
 		if r.refPos != site {
-			panic("CallSiteOnStrand: Not sorted by site")
-			return "", maxProb
+			panic("SiteProbsOnStrand: Not sorted by site")
 		}
 		// marginalize over the aligned pairs, only keeping the ones that are above our threshold
-		if r.prob >= threshold {
+		if threshold.Passes(r) {
 			base := r.base
 			prob := r.prob
 			probs[base] += prob
@@ -211,9 +223,8 @@ func (self *VcAlignment) CallSiteOnStrand(threshold float64) (string, float64) {
 			continue
 		}
 	}
-	// return empty string as null (no call)
 	if len(probs) == 0 {
-		return call, maxProb
+		return probs
 	}
 	normalizeProbs(&probs)
 	probsCheck := checkProbs(probs, 0.01)
@@ -221,30 +232,19 @@ func (self *VcAlignment) CallSiteOnStrand(threshold float64) (string, float64) {
 		err := fmt.Sprintf("normalization didn't work probs: %v", probs)
 		panic(err)
 	}
-
-	for base, prob := range probs {
-		if prob > maxProb {
-			maxProb = prob
-			call = base
-		}
-	}
-	return call, maxProb
+	return probs
 }
 
-// CallSiteOnCodingStrand respects that there can be template and complement alignments, it corrects to the forward/
-// template 'coding' orientation it aggregates the probabilities from both template and complement reads (assuming they
-// are above the threshold)
-func (self *VcAlignment) CallSiteOnCodingStrand(threshold float64) (string, float64) {
+// SiteProbsOnCodingStrand is like SiteProbsOnStrand but corrects each base to the forward/template 'coding'
+// orientation first, so template and complement reads can be aggregated
+func (self *VcAlignment) SiteProbsOnCodingStrand(threshold *ThresholdPolicy) map[string]float64 {
 	site := self.Records[0].refPos
 	probs := make(map[string]float64)
-	call := ""
-	maxProb := math.Inf(-1)
 	for _, r := range self.Records {
 		if r.refPos != site {
-			panic("CallSiteOnCodingStrand: Not sorted by site")
-			return "", maxProb
+			panic("SiteProbsOnCodingStrand: Not sorted by site")
 		}
-		if r.prob >= threshold {
+		if threshold.Passes(r) {
 			base := correctBaseForStrand(r.base, r.strand, r.forward)
 			probs[base] += r.prob
 		} else {
@@ -252,7 +252,7 @@ func (self *VcAlignment) CallSiteOnCodingStrand(threshold float64) (string, floa
 		}
 	}
 	if len(probs) == 0 {
-		return call, maxProb
+		return probs
 	}
 	normalizeProbs(&probs)
 	probsCheck := checkProbs(probs, 0.01)
@@ -260,7 +260,14 @@ func (self *VcAlignment) CallSiteOnCodingStrand(threshold float64) (string, floa
 		err := fmt.Sprintf("normalization didn't work probs: %v", probs)
 		panic(err)
 	}
+	return probs
+}
 
+// argmaxProb returns the base with the highest probability, or the empty string as null (no call) and -Inf when
+// probs is empty
+func argmaxProb(probs map[string]float64) (string, float64) {
+	call := ""
+	maxProb := math.Inf(-1)
 	for base, prob := range probs {
 		if prob > maxProb {
 			maxProb = prob
@@ -270,6 +277,51 @@ func (self *VcAlignment) CallSiteOnCodingStrand(threshold float64) (string, floa
 	return call, maxProb
 }
 
+// SecondBestProb returns the base with the highest probability other than call, or the empty string and 0 when
+// there isn't one
+func SecondBestProb(probs map[string]float64, call string) (string, float64) {
+	second := ""
+	secondProb := 0.0
+	for base, prob := range probs {
+		if base == call {
+			continue
+		}
+		if second == "" || prob > secondProb || (prob == secondProb && base < second) {
+			second = base
+			secondProb = prob
+		}
+	}
+	return second, secondProb
+}
+
+// ProbEntropy is the Shannon entropy of the distribution in bits, 0 for a single base and log2(n) for n equally
+// likely bases, NaN when probs is empty
+func ProbEntropy(probs map[string]float64) float64 {
+	if len(probs) == 0 {
+		return math.NaN()
+	}
+	var entropy float64 = 0.0
+	for _, prob := range probs {
+		if prob > 0 {
+			entropy -= prob * math.Log2(prob)
+		}
+	}
+	return entropy
+}
+
+// CallSiteOnStrand does not correct for forward/backward template/complement, it just calls the base with the argmax
+// probability
+func (self *VcAlignment) CallSiteOnStrand(threshold *ThresholdPolicy) (string, float64) {
+	return argmaxProb(self.SiteProbsOnStrand(threshold))
+}
+
+// CallSiteOnCodingStrand respects that there can be template and complement alignments, it corrects to the forward/
+// template 'coding' orientation it aggregates the probabilities from both template and complement reads (assuming they
+// are above the threshold)
+func (self *VcAlignment) CallSiteOnCodingStrand(threshold *ThresholdPolicy) (string, float64) {
+	return argmaxProb(self.SiteProbsOnCodingStrand(threshold))
+}
+
 func SortedKeys(m map[int]string) []int {
 	sK := make([]int, 0)
 	for k := range m {
@@ -279,15 +331,18 @@ func SortedKeys(m map[int]string) []int {
 	return sK
 }
 
+// VariantCall is a call at one site on one read, Prob is the normalized probability of the call (NaN for motif
+// calls that combine two sites)
 type VariantCall struct {
 	RefPos int
 	ReadLabel string
 	ReadScore float64
 	Call   string
+	Prob   float64
 }
 
-func VariantCallConstruct(refPos int, call string, readLabel string, readScore float64) *VariantCall {
-	return &VariantCall{RefPos: refPos, Call: call, ReadLabel: readLabel, ReadScore: readScore}
+func VariantCallConstruct(refPos int, call string, prob float64, readLabel string, readScore float64) *VariantCall {
+	return &VariantCall{RefPos: refPos, Call: call, Prob: prob, ReadLabel: readLabel, ReadScore: readScore}
 }
 
 func (self VariantCall) String() string {
@@ -310,23 +365,23 @@ func CallGatcMotifs(sortedSites []int, calls map[int]string, readLabel string, r
 		}
 		switch {
 		case siteCall == "" || rcSiteCall == "":
-			vc := VariantCallConstruct(site, "unclassified", readLabel, readScore)
+			vc := VariantCallConstruct(site, "unclassified", math.NaN(), readLabel, readScore)
 			variantCalls = append(variantCalls, vc)
 		case siteCall == rcSiteCall && siteCall == "A":
-			vc := VariantCallConstruct(site, "unmethylated", readLabel, readScore)
+			vc := VariantCallConstruct(site, "unmethylated", math.NaN(), readLabel, readScore)
 			variantCalls = append(variantCalls, vc)
 		case siteCall == rcSiteCall && siteCall == "I":
-			vc := VariantCallConstruct(site, "methylated", readLabel, readScore)
+			vc := VariantCallConstruct(site, "methylated", math.NaN(), readLabel, readScore)
 			variantCalls = append(variantCalls, vc)
 		case siteCall != rcSiteCall:
-			vc := VariantCallConstruct(site, "hemi-methylated", readLabel, readScore)
+			vc := VariantCallConstruct(site, "hemi-methylated", math.NaN(), readLabel, readScore)
 			variantCalls = append(variantCalls, vc)
 		}
 	}
 	return variantCalls
 }
 
-func CallSingleMoleculeGatcMethylation(alignment *VcAlignment, threshold float64) [][]*VariantCall {
+func CallSingleMoleculeGatcMethylation(alignment *VcAlignment, threshold *ThresholdPolicy) [][]*VariantCall {
 	results := make([][]*VariantCall, 0)
 	// alignment is not sorted by read, so sort by read (single molecules) first
 	byRead := alignment.GroupByRead()
@@ -348,7 +403,7 @@ func CallSingleMoleculeGatcMethylation(alignment *VcAlignment, threshold float64
 	return results
 }
 
-func CallSingleMoleculeCanonicalVariants(alignment *VcAlignment, threshold float64) [][]*VariantCall {
+func CallSingleMoleculeCanonicalVariants(alignment *VcAlignment, threshold *ThresholdPolicy) [][]*VariantCall {
 	results := make([][]*VariantCall, 0)
 	// alignment is not sorted by read, so sort by read (single molecules) first
 	byRead := alignment.GroupByRead()
@@ -359,14 +414,16 @@ func CallSingleMoleculeCanonicalVariants(alignment *VcAlignment, threshold float
 		bySite := aln.GroupBySite()
 		// strandCalls is a map of sites to calls, map[site]call
 		strandCalls := make(map[int]string)
+		strandProbs := make(map[int]float64)
 		for site, alignedPairs := range bySite {
 			// call the reference position
-			call, _ := alignedPairs.CallSiteOnCodingStrand(threshold)
+			call, prob := alignedPairs.CallSiteOnCodingStrand(threshold)
 			strandCalls[site] = call
+			strandProbs[site] = prob
 		}
 		calls := make([]*VariantCall, 0)  // could make this length known
 		for site, call := range strandCalls {
-			vc := VariantCallConstruct(site, call, readLabel, readScore)
+			vc := VariantCallConstruct(site, call, strandProbs[site], readLabel, readScore)
 			calls = append(calls, vc)
 		}
 		results = append(results, calls)
@@ -374,7 +431,7 @@ func CallSingleMoleculeCanonicalVariants(alignment *VcAlignment, threshold float
 	return results
 }
 
-func CallSingleMoleculeMethylation(alignment *VcAlignment, threshold float64) [][]*VariantCall {
+func CallSingleMoleculeMethylation(alignment *VcAlignment, threshold *ThresholdPolicy) [][]*VariantCall {
 	results := make([][]*VariantCall, 0)
 	// alignment is not sorted by read, so sort by read (single molecules) first
 	byRead := alignment.GroupByRead()
@@ -385,14 +442,16 @@ func CallSingleMoleculeMethylation(alignment *VcAlignment, threshold float64) []
 		bySite := aln.GroupBySite()
 		// strandCalls is a map of sites to calls, map[site]call
 		strandCalls := make(map[int]string)
+		strandProbs := make(map[int]float64)
 		for site, alignedPairs := range bySite {
 			// call the reference position
-			call, _ := alignedPairs.CallSiteOnStrand(threshold)
+			call, prob := alignedPairs.CallSiteOnStrand(threshold)
 			strandCalls[site] = call
+			strandProbs[site] = prob
 		}
 		calls := make([]*VariantCall, 0)  // could make this length known
 		for site, call := range strandCalls {
-			vc := VariantCallConstruct(site, call, readLabel, readScore)
+			vc := VariantCallConstruct(site, call, strandProbs[site], readLabel, readScore)
 			calls = append(calls, vc)
 		}
 		results = append(results, calls)
@@ -400,7 +459,7 @@ func CallSingleMoleculeMethylation(alignment *VcAlignment, threshold float64) []
 	return results
 }
 
-func CallSiteMethylation(siteSorted *VcAlignment, threshold float64) (string, int, float64) {
+func CallSiteMethylation(siteSorted *VcAlignment, threshold *ThresholdPolicy) (string, int, float64) {
 	call, prob := siteSorted.CallSiteOnStrand(threshold)
 	coverage := coverage(siteSorted)
 	return call, coverage, prob
@@ -411,7 +470,7 @@ func coverage(siteSorted *VcAlignment) int {
 	return len(byRead)
 }
 
-func CallSite(siteSorted *VcAlignment, threshold float64) (string, int, float64) {
+func CallSite(siteSorted *VcAlignment, threshold *ThresholdPolicy) (string, int, float64) {
 	call, prob := siteSorted.CallSiteOnCodingStrand(threshold)
 	coverage := coverage(siteSorted)
 	return call, coverage, prob
@@ -443,17 +502,27 @@ func ParseAlignmentFile(file io.Reader, vca *VcAlignment) {
 	return
 }
 
+// SiteCallStats counts the methylated calls at a site, ambiguous calls (see AddLlrCall) and reads without a call are
+// not included in nCalls, so the intervals are over the reads that made a call. It also keeps each read's posterior
+// probability that the site is methylated
 type SiteCallStats struct {
 		nMethylCalls int
 		nCalls int
+		nAmbiguous int
+		posteriors []float64
 }
 
 func SiteCallStatsConstruct() *SiteCallStats {
-	return &SiteCallStats{nMethylCalls: 0, nCalls: 0}
+	return &SiteCallStats{nMethylCalls: 0, nCalls: 0, nAmbiguous: 0, posteriors: make([]float64, 0)}
+}
+
+// isMethylBase is true for the symbols signalAlign uses for modified bases
+func isMethylBase(base string) bool {
+	return base == "E" || base == "I"
 }
 
 func (self *SiteCallStats) AddCall(call string) {
-	if call == "E" || call == "I" {
+	if isMethylBase(call) {
 		self.nMethylCalls += 1
 		self.nCalls += 1
 	} else {
@@ -461,10 +530,91 @@ func (self *SiteCallStats) AddCall(call string) {
 	}
 }
 
+// AddLlrCall calls the site methylated if the log-likelihood ratio of modified vs canonical is above cutoff and
+// canonical if it's below -cutoff, anything in between (or NaN, no call) is counted as ambiguous
+func (self *SiteCallStats) AddLlrCall(llr, cutoff float64) {
+	switch {
+	case llr > cutoff:
+		self.nMethylCalls += 1
+		self.nCalls += 1
+	case llr < -cutoff:
+		self.nCalls += 1
+	default:
+		self.nAmbiguous += 1
+	}
+}
+
+// AddPosterior adds one read's P(methylated) at the site, NaN (no call) is ignored
+func (self *SiteCallStats) AddPosterior(p float64) {
+	if math.IsNaN(p) {
+		return
+	}
+	self.posteriors = append(self.posteriors, p)
+}
+
+func (self *SiteCallStats) NumberOfPosteriors() int {
+	return len(self.posteriors)
+}
+
+// PosteriorPercentMethylated estimates the percent of molecules methylated at the site as the mean of the reads'
+// posteriors
+func (self *SiteCallStats) PosteriorPercentMethylated() float64 {
+	return 100 * meanFloat(self.posteriors)
+}
+
+// PosteriorInterval is a normal approximation 1 - alpha confidence interval on PosteriorPercentMethylated, clamped
+// to [0, 100]. It needs at least 2 reads, otherwise the bounds are NaN
+func (self *SiteCallStats) PosteriorInterval(alpha float64) (float64, float64) {
+	n := len(self.posteriors)
+	if n < 2 {
+		return math.NaN(), math.NaN()
+	}
+	mean := meanFloat(self.posteriors)
+	halfWidth := zScore(alpha) * stdDevFloat(self.posteriors) / math.Sqrt(float64(n))
+	return 100 * math.Max(0, mean-halfWidth), 100 * math.Min(1, mean+halfWidth)
+}
+
+// PercentMethylatedCalls is NaN when there are no calls at the site
 func (self *SiteCallStats) PercentMethylatedCalls() float64 {
+	if self.nCalls == 0 {
+		return math.NaN()
+	}
 	return (float64(self.nMethylCalls) / float64(self.nCalls)) * 100
 }
 
+// WilsonInterval is the 1 - alpha Wilson score interval on PercentMethylatedCalls
+func (self *SiteCallStats) WilsonInterval(alpha float64) (float64, float64) {
+	lo, hi := WilsonInterval(self.nMethylCalls, self.nCalls, alpha)
+	return 100 * lo, 100 * hi
+}
+
+// ClopperPearsonInterval is the exact 1 - alpha interval on PercentMethylatedCalls
+func (self *SiteCallStats) ClopperPearsonInterval(alpha float64) (float64, float64) {
+	lo, hi := ClopperPearsonInterval(self.nMethylCalls, self.nCalls, alpha)
+	return 100 * lo, 100 * hi
+}
+
+// BootstrapInterval resamples the reads' calls with replacement nBootstrap times and returns the percentile 1 - alpha
+// interval on PercentMethylatedCalls
+func (self *SiteCallStats) BootstrapInterval(nBootstrap int, alpha float64, rng *rand.Rand) (float64, float64) {
+	if self.nCalls == 0 || nBootstrap < 1 {
+		return math.NaN(), math.NaN()
+	}
+	replicates := make([]float64, nBootstrap)
+	for b := 0; b < nBootstrap; b++ {
+		nMethyl := 0
+		for i := 0; i < self.nCalls; i++ {
+			// each read is methylated or not, so drawing a read is drawing against the methylated fraction
+			if rng.Intn(self.nCalls) < self.nMethylCalls {
+				nMethyl += 1
+			}
+		}
+		replicates[b] = 100 * float64(nMethyl) / float64(self.nCalls)
+	}
+	sort.Float64s(replicates)
+	return percentile(replicates, alpha/2), percentile(replicates, 1-alpha/2)
+}
+
 func (self *SiteCallStats) PercentCanonicalCalls() float64 {
 	return 100.0 - self.PercentMethylatedCalls()
 }
@@ -472,3 +622,61 @@ func (self *SiteCallStats) PercentCanonicalCalls() float64 {
 func (self *SiteCallStats) NumberOfCalls() int {
 	return self.nCalls
 }
+
+func (self *SiteCallStats) NumberOfMethylatedCalls() int {
+	return self.nMethylCalls
+}
+
+func (self *SiteCallStats) NumberOfAmbiguousCalls() int {
+	return self.nAmbiguous
+}
+
+// Merge adds the calls from other into this site, used when aggregating sites into windows
+func (self *SiteCallStats) Merge(other *SiteCallStats) {
+	self.nMethylCalls += other.nMethylCalls
+	self.nCalls += other.nCalls
+	self.nAmbiguous += other.nAmbiguous
+	self.posteriors = append(self.posteriors, other.posteriors...)
+}
+
+// SingleMoleculeSiteCalls calls each site on each read and accumulates the calls into a map of ref_positions to
+// call stats
+func SingleMoleculeSiteCalls(alignment *VcAlignment, threshold *ThresholdPolicy) map[int]*SiteCallStats {
+	siteCalls := make(map[int]*SiteCallStats)
+	// group by read first, because there could be many more sites than reads, and each read will only
+	// map to a subset of the sites
+	byRead := alignment.GroupByRead()
+	for _, readDf := range byRead {
+		// now go over all the sites reported on by this read
+		bySite := readDf.GroupBySite()
+		for site, siteDf := range bySite {
+			_, check := siteCalls[site]
+			if !check {
+				siteCalls[site] = SiteCallStatsConstruct()
+			}
+			siteCalls[site].addRead(siteDf, threshold)
+		}
+	}
+	return siteCalls
+}
+
+// addRead adds the call and the posterior for one read's aligned pairs at the site, a read with nothing above the
+// threshold has no call and isn't counted at all
+func (self *SiteCallStats) addRead(readSiteDf *VcAlignment, threshold *ThresholdPolicy) {
+	probs := readSiteDf.SiteProbsOnStrand(threshold)
+	call, _ := argmaxProb(probs)
+	if call == "" {
+		return
+	}
+	self.AddCall(call)
+	self.AddPosterior(MethylPosterior(probs))
+}
+
+// SiteMethylationStats is the single molecule call stats for one site, it groups the site's aligned pairs by read
+func SiteMethylationStats(siteSorted *VcAlignment, threshold *ThresholdPolicy) *SiteCallStats {
+	stats := SiteCallStatsConstruct()
+	for _, readSiteDf := range siteSorted.GroupByRead() {
+		stats.addRead(readSiteDf, threshold)
+	}
+	return stats
+}
@@ -3,28 +3,53 @@ package VClr
 import (
 	"testing"
 	"github.com/stretchr/testify/assert"
-	"os"
 	"fmt"
 )
 
-func getTestingFile() string {
-	file := "../oneOfEach.tsv"
-	_, ok := os.Stat(file)
-	if ok != nil {
-		panic("Didn't find testing file")
+// oneOfEach has a read for each GATC motif call, 5 is the A in GATC and 6 is the A on the other strand. r3 is a
+// complement read
+const oneOfEach = "ref\t5\tA\t0.9\tt\tforward\tr1\n" +
+	"ref\t5\tI\t0.1\tt\tforward\tr1\n" +
+	"ref\t6\tA\t0.7\tt\tforward\tr1\n" +
+	"ref\t6\tI\t0.3\tt\tforward\tr1\n" +
+	"ref\t5\tA\t0.2\tt\tforward\tr2\n" +
+	"ref\t5\tI\t0.8\tt\tforward\tr2\n" +
+	"ref\t6\tA\t0.1\tt\tforward\tr2\n" +
+	"ref\t6\tI\t0.9\tt\tforward\tr2\n" +
+	"ref\t5\tA\t0.3\tc\tforward\tr3\n" +
+	"ref\t5\tI\t0.7\tc\tforward\tr3\n" +
+	"ref\t6\tA\t0.8\tc\tforward\tr3\n" +
+	"ref\t6\tI\t0.2\tc\tforward\tr3\n"
+
+func oneOfEachAlignment() *VcAlignment {
+	return alignmentFromString(oneOfEach)
+}
+
+// canonicalAlignment is one read with a template and complement strand over 18 sites that are all A, the template
+// gets site 3 wrong but the complement outweighs it
+func canonicalAlignment() *VcAlignment {
+	table := ""
+	for site := 0; site < 18; site++ {
+		if site == 3 {
+			table += "ref\t3\tC\t0.6\tt\tforward\tr1\n" + "ref\t3\tA\t0.4\tt\tforward\tr1\n"
+		} else {
+			table += fmt.Sprintf("ref\t%v\tA\t0.9\tt\tforward\tr1\n", site) +
+				fmt.Sprintf("ref\t%v\tG\t0.1\tt\tforward\tr1\n", site)
+		}
+		// the complement reads the reverse complement
+		table += fmt.Sprintf("ref\t%v\tT\t0.9\tc\tforward\tr1\n", site) +
+			fmt.Sprintf("ref\t%v\tG\t0.1\tc\tforward\tr1\n", site)
 	}
-	return file
+	return alignmentFromString(table)
 }
 
 func TestParseAlignmentFile(t *testing.T) {
-	file := getTestingFile()
-	vca := ParseAlignmentFile(file)
-	assert.True(t, len(vca.Records) == 70, "Incorrect number of records, got %v", len(vca.Records))
+	vca := oneOfEachAlignment()
+	assert.True(t, len(vca.Records) == 12, "Incorrect number of records, got %v", len(vca.Records))
 }
 
 func TestVcAlignment_GroupByRead(t *testing.T) {
-	file := getTestingFile()
-	vca := ParseAlignmentFile(file)
+	vca := oneOfEachAlignment()
 	byRead := vca.GroupByRead()
 	reads := 0
 	for _ = range byRead {
@@ -34,15 +59,13 @@ func TestVcAlignment_GroupByRead(t *testing.T) {
 }
 
 func TestVcAlignment_GroupBySite(t *testing.T) {
-	file := getTestingFile()
-	vca := ParseAlignmentFile(file)
+	vca := oneOfEachAlignment()
 	bySite := vca.GroupBySite()
 	assert.True(t, len(bySite) == 2)
 }
 
 func TestVcAlignment_GroupByStrand(t *testing.T) {
-	file := getTestingFile()
-	vca := ParseAlignmentFile(file)
+	vca := oneOfEachAlignment()
 	byStrand := vca.GroupByStrand()
 	for strand, aln := range byStrand {
 		for _, r := range aln.Records {
@@ -52,9 +75,8 @@ func TestVcAlignment_GroupByStrand(t *testing.T) {
 }
 
 func TestCallGatcMotifs(t *testing.T) {
-	file := getTestingFile()
-	vca := ParseAlignmentFile(file)
-	results := CallSingleMoleculeGatcMethylation(vca, 0.1)
+	vca := oneOfEachAlignment()
+	results := CallSingleMoleculeGatcMethylation(vca, ThresholdPolicyConstruct(0.1))
 	unmethylCalls := 0
 	methylCalls := 0
 	hemiMethylCalls := 0
@@ -78,20 +100,14 @@ func TestCallGatcMotifs(t *testing.T) {
 }
 
 func TestCallSingleMoleculeMethylation(t *testing.T) {
-	file := getTestingFile()
-	vca := ParseAlignmentFile(file)
-	results := CallSingleMoleculeMethylation(vca, 0.0)
-	fmt.Println(results)
+	vca := oneOfEachAlignment()
+	results := CallSingleMoleculeMethylation(vca, ThresholdPolicyConstruct(0.0))
+	assert.True(t, len(results) == len(vca.GroupByRead()))
 }
 
 func TestCallSingleMoleculeCanonicalVariants(t *testing.T) {
-	file := "../canonical_vc.tsv"
-	_, ok := os.Stat(file)
-	if ok != nil {
-		panic("Didn't find testing file")
-	}
-	vca := ParseAlignmentFile(file)
-	results := CallSingleMoleculeCanonicalVariants(vca, 0.1)
+	vca := canonicalAlignment()
+	results := CallSingleMoleculeCanonicalVariants(vca, ThresholdPolicyConstruct(0.1))
 	assert.True(t, len(results) == 1)
 	for _, readResult := range results {
 		assert.True(t, len(readResult) == 18)
@@ -118,32 +134,23 @@ func strandAccuracyTest(results [][]*VariantCall) float64 {
 }
 
 func TestStrandAccuracy(t *testing.T) {
-	file := "../canonical_vc.tsv"
-	_, ok := os.Stat(file)
-	if ok != nil {
-		panic("Didn't find testing file")
-	}
-	vca := ParseAlignmentFile(file)
+	vca := canonicalAlignment()
 	byStrand := vca.GroupByStrand()
-	results := CallSingleMoleculeCanonicalVariants(byStrand["t"], 0.1)
+	results := CallSingleMoleculeCanonicalVariants(byStrand["t"], ThresholdPolicyConstruct(0.1))
 	percentCorrect := strandAccuracyTest(results)
 	assert.True(t, percentCorrect >= 80)
-	results = CallSingleMoleculeCanonicalVariants(byStrand["c"], 0.1)
+	results = CallSingleMoleculeCanonicalVariants(byStrand["c"], ThresholdPolicyConstruct(0.1))
 	percentCorrect = strandAccuracyTest(results)
 	assert.True(t, percentCorrect >= 80)
 }
 
 func TestCallSiteMethylation (t *testing.T) {
-	file := "../probs.tsv"
-	_, ok := os.Stat(file)
-	if ok != nil {
-		panic("Didn't find testing file")
-	}
-	vca := ParseAlignmentFile(file)
+	vca := oneOfEachAlignment()
 	bySite_template := vca.GroupByStrand()["t"].GroupBySite()
 	//bySite := vca.GroupBySite()
 	for site, aln := range bySite_template {
-		call := CallSiteMethylation(aln, 0.0)
-		fmt.Println(site, call)
+		call, coverage, _ := CallSiteMethylation(aln, ThresholdPolicyConstruct(0.0))
+		assert.True(t, call != "", "no call at site %v", site)
+		assert.True(t, coverage == 2)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,150 @@
+package VClr
+
+import (
+	"sort"
+)
+
+// MethylationWindow summarizes the site level methylation over a window or feature, Start and End are inclusive.
+// Heterogeneity is measured on single molecules: of the reads with at least two calls in the window, the fraction
+// that have both methylated and canonical calls
+type MethylationWindow struct {
+	Name                string
+	Start               int
+	End                 int
+	NSites              int
+	Coverage            int
+	sumPercentMethyl    float64
+	nInformativeReads   int
+	nHeterogeneousReads int
+}
+
+func MethylationWindowConstruct(name string, start, end int) *MethylationWindow {
+	return &MethylationWindow{Name: name, Start: start, End: end, NSites: 0, Coverage: 0, sumPercentMethyl: 0.0,
+		nInformativeReads: 0, nHeterogeneousReads: 0}
+}
+
+// MeanPercentMethylated is the mean over the sites in the window of the percent methylated calls
+func (self *MethylationWindow) MeanPercentMethylated() float64 {
+	return self.sumPercentMethyl / float64(self.NSites)
+}
+
+func (self *MethylationWindow) NumberOfInformativeReads() int {
+	return self.nInformativeReads
+}
+
+func (self *MethylationWindow) Heterogeneity() float64 {
+	return float64(self.nHeterogeneousReads) / float64(self.nInformativeReads)
+}
+
+func (self *MethylationWindow) addSite(stats *SiteCallStats) {
+	self.NSites += 1
+	self.Coverage += stats.NumberOfCalls()
+	self.sumPercentMethyl += stats.PercentMethylatedCalls()
+}
+
+// aggregateWindows fills in the windows, regionsFor maps a reference position to the indices of the windows it falls
+// in. Windows with fewer than minSites sites are dropped
+func aggregateWindows(windows []*MethylationWindow, regionsFor func(pos int) []int,
+	siteCalls map[int]*SiteCallStats, readCalls [][]*VariantCall, minSites int) []*MethylationWindow {
+	for site, stats := range siteCalls {
+		if stats.NumberOfCalls() == 0 {
+			continue
+		}
+		for _, i := range regionsFor(site) {
+			windows[i].addSite(stats)
+		}
+	}
+	for _, calls := range readCalls {
+		// number of methylated and canonical calls this read has in each window it touches
+		nMethyl := make(map[int]int)
+		nCanonical := make(map[int]int)
+		touched := make(map[int]bool)
+		for _, vc := range calls {
+			if vc.Call == "" {
+				continue
+			}
+			for _, i := range regionsFor(vc.RefPos) {
+				touched[i] = true
+				if isMethylBase(vc.Call) {
+					nMethyl[i] += 1
+				} else {
+					nCanonical[i] += 1
+				}
+			}
+		}
+		for i := range touched {
+			if nMethyl[i]+nCanonical[i] < 2 {
+				continue
+			}
+			windows[i].nInformativeReads += 1
+			if nMethyl[i] > 0 && nCanonical[i] > 0 {
+				windows[i].nHeterogeneousReads += 1
+			}
+		}
+	}
+	kept := make([]*MethylationWindow, 0, len(windows))
+	for _, w := range windows {
+		if w.NSites >= minSites && w.NSites > 0 {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
+
+// SlidingWindowMethylation aggregates the site calls (from SingleMoleculeSiteCalls) and the per-read calls (from
+// CallSingleMoleculeMethylation) into windows of size window every step positions, starting at 0
+func SlidingWindowMethylation(siteCalls map[int]*SiteCallStats, readCalls [][]*VariantCall, window, step,
+	minSites int) []*MethylationWindow {
+	if window < 1 || step < 1 {
+		panic("SlidingWindowMethylation: window and step need to be positive")
+	}
+	if len(siteCalls) == 0 {
+		return make([]*MethylationWindow, 0)
+	}
+	sites := make([]int, 0, len(siteCalls))
+	for site := range siteCalls {
+		sites = append(sites, site)
+	}
+	sort.Ints(sites)
+	first := sites[0]
+	last := sites[len(sites)-1]
+	// the first window that can contain the first site
+	firstStart := 0
+	if first-window+1 > 0 {
+		firstStart = ((first - window + 1 + step - 1) / step) * step
+	}
+	windows := make([]*MethylationWindow, 0)
+	for start := firstStart; start <= last; start += step {
+		windows = append(windows, MethylationWindowConstruct("", start, start+window-1))
+	}
+	// the windows are sorted by both start and end, so find the first one ending at or after pos
+	regionsFor := func(pos int) []int {
+		regions := make([]int, 0)
+		lo := sort.Search(len(windows), func(i int) bool { return windows[i].End >= pos })
+		for i := lo; i < len(windows) && windows[i].Start <= pos; i++ {
+			regions = append(regions, i)
+		}
+		return regions
+	}
+	return aggregateWindows(windows, regionsFor, siteCalls, readCalls, minSites)
+}
+
+// FeatureMethylation aggregates the site calls and per-read calls over features, like SlidingWindowMethylation
+func FeatureMethylation(siteCalls map[int]*SiteCallStats, readCalls [][]*VariantCall, features []*Feature,
+	minSites int) []*MethylationWindow {
+	windows := make([]*MethylationWindow, len(features))
+	featureIdx := make(map[*Feature]int)
+	for i, f := range features {
+		windows[i] = MethylationWindowConstruct(f.Name, f.Start, f.End-1)
+		featureIdx[f] = i
+	}
+	index := FeatureIndexConstruct(features)
+	regionsFor := func(pos int) []int {
+		regions := make([]int, 0)
+		for _, f := range index.Overlapping(pos) {
+			regions = append(regions, featureIdx[f])
+		}
+		return regions
+	}
+	return aggregateWindows(windows, regionsFor, siteCalls, readCalls, minSites)
+}
@@ -0,0 +1,58 @@
+package VClr
+
+import (
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func windowsTestAlignment() *VcAlignment {
+	return alignmentFromString(
+		"ref\t2\tI\t0.9\tt\tforward\tr1\n" +
+		"ref\t4\tA\t0.9\tt\tforward\tr1\n" +
+		"ref\t2\tI\t0.9\tt\tforward\tr2\n" +
+		"ref\t4\tI\t0.9\tt\tforward\tr2\n" +
+		"ref\t12\tA\t0.9\tt\tforward\tr2\n")
+}
+
+func TestSlidingWindowMethylation(t *testing.T) {
+	vca := windowsTestAlignment()
+	siteCalls := SingleMoleculeSiteCalls(vca, ThresholdPolicyConstruct(0.0))
+	readCalls := CallSingleMoleculeMethylation(vca, ThresholdPolicyConstruct(0.0))
+	windows := SlidingWindowMethylation(siteCalls, readCalls, 10, 5, 1)
+	// [0,9] [5,14] and [10,19]
+	assert.True(t, len(windows) == 3)
+	first := windows[0]
+	assert.True(t, first.Start == 0 && first.End == 9 && first.NSites == 2 && first.Coverage == 4)
+	assert.InDelta(t, 75.0, first.MeanPercentMethylated(), 1e-9)
+	// r1 is mixed, r2 is all methylated
+	assert.True(t, first.NumberOfInformativeReads() == 2)
+	assert.InDelta(t, 0.5, first.Heterogeneity(), 1e-9)
+	assert.True(t, windows[1].Start == 5 && windows[1].NSites == 1)
+
+	windows = SlidingWindowMethylation(siteCalls, readCalls, 10, 5, 2)
+	assert.True(t, len(windows) == 1)
+}
+
+func TestFeatureMethylation(t *testing.T) {
+	bed := "track name=test\n" +
+		"ref\t0\t5\tgeneA\t0\t+\n" +
+		"ref\t3\t20\tgeneB\t0\t-\n" +
+		"ref\t30\t40\tgeneC\n"
+	features := ParseBed(strings.NewReader(bed))
+	assert.True(t, len(features) == 3)
+	assert.True(t, features[1].Strand == "-" && features[2].Strand == ".")
+	index := FeatureIndexConstruct(features)
+	assert.True(t, len(index.Overlapping(4)) == 2)
+	assert.True(t, len(index.Overlapping(5)) == 1)
+	assert.True(t, len(index.Overlapping(25)) == 0)
+
+	vca := windowsTestAlignment()
+	threshold := ThresholdPolicyConstruct(0.0)
+	windows := FeatureMethylation(SingleMoleculeSiteCalls(vca, threshold), CallSingleMoleculeMethylation(vca, threshold),
+		features, 1)
+	assert.True(t, len(windows) == 2)
+	assert.True(t, windows[0].Name == "geneA" && windows[0].NSites == 2)
+	assert.True(t, windows[1].Name == "geneB" && windows[1].NSites == 2 && windows[1].End == 19)
+	assert.InDelta(t, 25.0, windows[1].MeanPercentMethylated(), 1e-9)
+}